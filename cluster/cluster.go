@@ -79,6 +79,7 @@ type NodeFacade struct{
 	Handler   *dbrpc.Handler
 	Nodes     map[string]*NodeObject
 	Dayfile   map[uuid.UUID]*NodeObject
+	RpcOptions *server.Options // Options for outgoing connections.
 	mutex sync.Mutex
 	
 	dfid  *uuid.UUID
@@ -125,7 +126,7 @@ func (n *NodeFacade) insert(e *memberlist.Node, ni *NodeInfo) {
 	if !ok { return }
 	
 	ta := net.TCPAddr{IP:e.Addr,Port:ni.RpcPort}
-	node.Client = server.NewClientWithFunc(ta.String(),fu)
+	node.Client = server.NewClientWith(ta.String(),fu,n.RpcOptions)
 	
 	n.Nodes[e.Name] = node
 	if node.Info.DayfileNode!=nil {
@@ -168,12 +169,18 @@ type nfDayfileNode struct{
 }
 func (n nfDayfileNode) ReadDayfileBlob(b messagedb.AbstractBlob) messagedb.AbstractBlob {
 	if b==nil || b.IsDirect() { return b }
-	bl,ok := b.(*messagedb.BlobLocation)
-	if !ok || bl==nil { return nil }
-	if *(bl.Node) == *(n.node.dfid) {
+	var node *uuid.UUID
+	switch bl := b.(type) {
+	case *messagedb.BlobLocation:
+		if bl!=nil { node = bl.Node }
+	case *messagedb.BlobContentRef:
+		if bl!=nil { node = bl.Node }
+	}
+	if node==nil { return nil }
+	if *node == *(n.node.dfid) {
 		return n.node.backup[0].DayfileDB.ReadDayfileBlob(b)
 	}
-	on,ok := n.node.Dayfile[*(bl.Node)]
+	on,ok := n.node.Dayfile[*node]
 	if !ok { return nil }
 	return on.Client.ReadDayfileBlob(b)
 }
@@ -0,0 +1,225 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+/*
+Administrative commands for an articledb storage node.
+
+	articledb-admin [-db file] <command> [args...]
+
+Commands:
+
+	dict-retrain [samples] [size]   Trains a new head dictionary.
+	dict-reencode                   Re-encodes the stored heads with the current dictionary.
+	export <folder> <first> <last> <file>
+	                                Exports the articles stored in the dayfiles first..last.
+	import <folder> <file>          Imports an archive into the dayfiles in folder.
+	group-gc [hours]                Deletes group tombstones older than hours (default 720).
+	inn-import <active> [newsgroups]
+	                                Imports the groups from INN's active and newsgroups files.
+	inn-export <active> [newsgroups]
+	                                Writes the groups as INN active and newsgroups files.
+*/
+package main
+
+import "github.com/byte-mug/articledb/messagedb"
+import "github.com/byte-mug/articledb/groupsdb"
+import "github.com/byte-mug/articledb/groupsdb/innfile"
+import "github.com/boltdb/bolt"
+import "flag"
+import "fmt"
+import "os"
+import "strconv"
+import "time"
+
+type command func(db *bolt.DB, args []string) error
+
+var commands = map[string]command{
+	"dict-retrain": dictRetrain,
+	"dict-reencode": dictReencode,
+	"export": exportArchive,
+	"import": importArchive,
+	"group-gc": groupGC,
+	"inn-import": innImport,
+	"inn-export": innExport,
+}
+
+func intArg(args []string, i int, def int) int {
+	if len(args)<=i { return def }
+	n,err := strconv.Atoi(args[i])
+	if err!=nil { return def }
+	return n
+}
+
+func openDicts(db *bolt.DB) (*messagedb.GrpArtDB,*messagedb.DictionaryDB,error) {
+	arts := &messagedb.GrpArtDB{DB:db}
+	dicts := &messagedb.DictionaryDB{DB:db}
+	if err := arts.Initialize(); err!=nil { return nil,nil,err }
+	if err := dicts.Initialize(); err!=nil { return nil,nil,err }
+	return arts,dicts,nil
+}
+
+func dictRetrain(db *bolt.DB, args []string) error {
+	arts,dicts,err := openDicts(db)
+	if err!=nil { return err }
+	samples := arts.SampleHeads(intArg(args,0,10000))
+	id,err := dicts.Train(samples,intArg(args,1,64<<10))
+	if err!=nil { return err }
+	fmt.Printf("trained dictionary %d from %d heads\n",id,len(samples))
+	return nil
+}
+
+func dictReencode(db *bolt.DB, args []string) error {
+	arts,dicts,err := openDicts(db)
+	if err!=nil { return err }
+	n,err := arts.ReencodeHeads(dicts)
+	fmt.Printf("re-encoded %d heads\n",n)
+	return err
+}
+
+func openDayfiles(db *bolt.DB, folder string) (*messagedb.GrpArtDB,*messagedb.DayfileCache,error) {
+	arts := &messagedb.GrpArtDB{DB:db}
+	if err := arts.Initialize(); err!=nil { return nil,nil,err }
+	dfc := &messagedb.DayfileCache{Folder:folder}
+	if err := dfc.Init(messagedb.NewLruCache(64)); err!=nil { return nil,nil,err }
+	return arts,dfc,nil
+}
+
+func exportArchive(db *bolt.DB, args []string) error {
+	if len(args)<4 { return fmt.Errorf("usage: export <folder> <first> <last> <file>") }
+	arts,dfc,err := openDayfiles(db,args[0])
+	if err!=nil { return err }
+	defer dfc.Close()
+	f,err := os.Create(args[3])
+	if err!=nil { return err }
+	defer f.Close()
+	n,err := arts.ExportArchive(f,dfc,intArg(args,1,0),intArg(args,2,0))
+	fmt.Printf("exported %d articles\n",n)
+	if err!=nil { return err }
+	return f.Sync()
+}
+
+func importArchive(db *bolt.DB, args []string) error {
+	if len(args)<2 { return fmt.Errorf("usage: import <folder> <file>") }
+	arts,dfc,err := openDayfiles(db,args[0])
+	if err!=nil { return err }
+	defer dfc.Close()
+	f,err := os.Open(args[1])
+	if err!=nil { return err }
+	defer f.Close()
+	n,err := arts.ImportArchive(f,dfc)
+	fmt.Printf("imported %d articles\n",n)
+	return err
+}
+
+func groupGC(db *bolt.DB, args []string) error {
+	groups,_,err := openGroups(db)
+	if err!=nil { return err }
+	n,err := groups.CollectTombstonesNRT(time.Duration(intArg(args,0,720))*time.Hour)
+	if err!=nil { return err }
+	fmt.Printf("deleted %d tombstones\n",n)
+	return nil
+}
+
+func openGroups(db *bolt.DB) (*groupsdb.GroupNRT,*groupsdb.GroupRTP,error) {
+	nrt := &groupsdb.GroupNRT{DB:db}
+	rtp := &groupsdb.GroupRTP{DB:db,Articles:&messagedb.GrpArtDB{DB:db}}
+	if err := nrt.Initialize(); err!=nil { return nil,nil,err }
+	if err := rtp.Initialize(); err!=nil { return nil,nil,err }
+	return nrt,rtp,nil
+}
+
+func innImport(db *bolt.DB, args []string) error {
+	if len(args)<1 { return fmt.Errorf("usage: inn-import <active> [newsgroups]") }
+	nrt,rtp,err := openGroups(db)
+	if err!=nil { return err }
+	f,err := os.Open(args[0])
+	if err!=nil { return err }
+	active,err := innfile.ReadActive(f)
+	f.Close()
+	if err!=nil { return err }
+	var descs map[string][]byte
+	if len(args)>1 {
+		f,err = os.Open(args[1])
+		if err!=nil { return err }
+		descs,err = innfile.ReadNewsgroups(f)
+		f.Close()
+		if err!=nil { return err }
+	}
+	n,err := innfile.Import(nrt,rtp,active,descs,time.Now().Unix())
+	if err!=nil { return err }
+	fmt.Printf("imported %d of %d groups\n",n,len(active))
+	return nil
+}
+
+func writeFile(name string, write func(f *os.File) error) error {
+	f,err := os.Create(name)
+	if err!=nil { return err }
+	defer f.Close()
+	if err = write(f); err!=nil { return err }
+	return f.Sync()
+}
+
+func innExport(db *bolt.DB, args []string) error {
+	if len(args)<1 { return fmt.Errorf("usage: inn-export <active> [newsgroups]") }
+	nrt,rtp,err := openGroups(db)
+	if err!=nil { return err }
+	active,groups,err := innfile.Export(nrt,rtp)
+	if err!=nil { return err }
+	err = writeFile(args[0],func(f *os.File) error { return innfile.WriteActive(f,active) })
+	if err!=nil { return err }
+	if len(args)>1 {
+		err = writeFile(args[1],func(f *os.File) error { return innfile.WriteNewsgroups(f,groups) })
+		if err!=nil { return err }
+	}
+	fmt.Printf("exported %d groups\n",len(active))
+	return nil
+}
+
+func main() {
+	dbfile := flag.String("db","articles.db","the bolt database file")
+	flag.Parse()
+	args := flag.Args()
+	if len(args)==0 {
+		fmt.Fprintln(os.Stderr,"usage: articledb-admin [-db file] <command> [args...]")
+		os.Exit(2)
+	}
+	cmd,ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr,"unknown command %q\n",args[0])
+		os.Exit(2)
+	}
+	db,err := bolt.Open(*dbfile,0600,nil)
+	if err!=nil {
+		fmt.Fprintln(os.Stderr,err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	err = cmd(db,args[1:])
+	if err!=nil {
+		fmt.Fprintln(os.Stderr,err)
+		db.Close()
+		os.Exit(1)
+	}
+}
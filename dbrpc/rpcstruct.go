@@ -31,8 +31,13 @@ import "github.com/byte-mug/golibs/serializer"
 import "github.com/byte-mug/articledb/groupsdb"
 import "github.com/byte-mug/articledb/messagedb"
 import "github.com/valyala/fastrpc"
+import "errors"
 import "time"
 
+// Returned by Client methods, if the server sent no (or an unexpected) response,
+// e.g. because the service isn't configured on the server, or it failed there.
+var ENoResponse = errors.New("no response from server")
+
 type Boolean byte
 func (b Boolean) Bool() bool { return b!=0 }
 func (pb *Boolean) From(b bool) { if b { *pb=0xff }else{ *pb=0 } }
@@ -92,6 +97,13 @@ var ce_ReqGetXover = serializer.StripawayPtrWith(new(ReqGetXover),serializer.Wit
 	Field("Max"))
 //
 
+type ReqGetArticleNumbers struct{
+	Group []byte
+}
+var ce_ReqGetArticleNumbers = serializer.StripawayPtrWith(new(ReqGetArticleNumbers),serializer.WithInline(new(ReqGetArticleNumbers)).
+	Field("Group"))
+//
+
 
 // ----------- END IGrpArtDB ----------------------
 
@@ -119,6 +131,17 @@ var ce_ReqAddDayfileBlob = serializer.StripawayPtrWith(new(ReqAddDayfileBlob),se
 	FieldWith("Data",messagedb.CeAbstractBlob()))
 //
 
+type ReqAddDayfileBlobAt struct{
+	TimeStamp int64
+	Comp      messagedb.CompressionHint
+	Data      messagedb.AbstractBlob
+}
+var ce_ReqAddDayfileBlobAt = serializer.StripawayPtrWith(new(ReqAddDayfileBlobAt),serializer.WithInline(new(ReqAddDayfileBlobAt)).
+	Field("TimeStamp").
+	Field("Comp").
+	FieldWith("Data",messagedb.CeAbstractBlob()))
+//
+
 type ReqReadDayfileBlob struct{
 	Data  messagedb.AbstractBlob
 }
@@ -151,6 +174,65 @@ var ce_ReqGetGroupsNRT = serializer.StripawayPtrWith(new(ReqGetGroupsNRT),serial
 	Field("Suffix"))
 //
 
+type ReqGetGroupsWildmatNRT struct{
+	After, Wildmat []byte
+	Limit int
+}
+var ce_ReqGetGroupsWildmatNRT = serializer.StripawayPtrWith(new(ReqGetGroupsWildmatNRT),serializer.WithInline(new(ReqGetGroupsWildmatNRT)).
+	Field("After").
+	Field("Wildmat").
+	Field("Limit"))
+//
+
+type ReqDigestNRT struct{
+	Prefix []byte
+}
+var ce_ReqDigestNRT = serializer.StripawayPtrWith(new(ReqDigestNRT),serializer.WithInline(new(ReqDigestNRT)).
+	Field("Prefix"))
+//
+
+type ReqExportRangeNRT struct{
+	From, To []byte
+}
+var ce_ReqExportRangeNRT = serializer.StripawayPtrWith(new(ReqExportRangeNRT),serializer.WithInline(new(ReqExportRangeNRT)).
+	Field("From").
+	Field("To"))
+//
+
+type ReqListGroupsCreatedSince struct{
+	TimeStamp int64
+	Wildmat   []byte
+	After     []byte
+	Limit     int
+}
+var ce_ReqListGroupsCreatedSince = serializer.StripawayPtrWith(new(ReqListGroupsCreatedSince),serializer.WithInline(new(ReqListGroupsCreatedSince)).
+	Field("TimeStamp").
+	Field("Wildmat").
+	Field("After").
+	Field("Limit"))
+//
+
+type ReqGetGroupsActive struct{
+	Wildmat, After []byte
+	Limit int
+}
+var ce_ReqGetGroupsActive = serializer.StripawayPtrWith(new(ReqGetGroupsActive),serializer.WithInline(new(ReqGetGroupsActive)).
+	Field("Wildmat").
+	Field("After").
+	Field("Limit"))
+//
+
+type ReqGetGroupsPageNRT struct{
+	After, Prefix, Suffix []byte
+	Limit int
+}
+var ce_ReqGetGroupsPageNRT = serializer.StripawayPtrWith(new(ReqGetGroupsPageNRT),serializer.WithInline(new(ReqGetGroupsPageNRT)).
+	Field("After").
+	Field("Prefix").
+	Field("Suffix").
+	Field("Limit"))
+//
+
 type ReqPutGroupNRT struct{
 	Group []byte
 	Entry *groupsdb.GroupEntryNRT
@@ -159,6 +241,32 @@ var ce_ReqPutGroupNRT = serializer.StripawayPtrWith(new(ReqPutGroupNRT),serializ
 	Field("Group").
 	FieldWith("Entry",groupsdb.CeGroupEntryNRT()))
 //
+
+// The original requests above (and their responses) can't transfer
+// groupsdb.GroupEntryNRT.Alias. Their wire format is kept for peers, that
+// haven't been upgraded yet (see Client.Alias). The following versions use
+// the wire format including Alias.
+type ReqGetGroupNRTv1 ReqGetGroupNRT
+var ce_ReqGetGroupNRTv1 = serializer.StripawayPtrWith(new(ReqGetGroupNRTv1),serializer.WithInline(new(ReqGetGroupNRTv1)).
+	Field("Group"))
+
+type ReqGetGroupBulkNRTv1 ReqGetGroupBulkNRT
+var ce_ReqGetGroupBulkNRTv1 = serializer.StripawayPtrWith(new(ReqGetGroupBulkNRTv1),serializer.WithInline(new(ReqGetGroupBulkNRTv1)).
+	Field("Groups"))
+//
+
+type ReqGetGroupsNRTv1 ReqGetGroupsNRT
+var ce_ReqGetGroupsNRTv1 = serializer.StripawayPtrWith(new(ReqGetGroupsNRTv1),serializer.WithInline(new(ReqGetGroupsNRTv1)).
+	Field("After").
+	Field("Prefix").
+	Field("Suffix"))
+//
+
+type ReqPutGroupNRTv1 ReqPutGroupNRT
+var ce_ReqPutGroupNRTv1 = serializer.StripawayPtrWith(new(ReqPutGroupNRTv1),serializer.WithInline(new(ReqPutGroupNRTv1)).
+	Field("Group").
+	FieldWith("Entry",groupsdb.CeGroupEntryNRTv1()))
+//
 // ----------- END IGrpArtDB ----------------------
 
 // ----------- BEGIN IGroupNRT ----------------------
@@ -166,6 +274,8 @@ const (
 	RTP_GetGroupRTP         byte = iota
 	RTP_IncrementRTP
 	RTP_RollbackArticleRTP
+	RTP_IncrementRTPBy      // Artnum is the number of articles.
+	RTP_RecomputeRTP
 )
 type ReqGroupRTP struct{
 	Cmd    byte
@@ -176,6 +286,9 @@ var ce_ReqGroupRTP = serializer.With(new(ReqGroupRTP)).
 	Field("Cmd").
 	Field("Group").
 	Field("Artnum")
+
+// AllocateNumbers is sent as []groupsdb.GroupPairRTP: Key is the group, Value.Count
+// the number of articles. The response carries the ranges as Value.Low..Value.High.
 // ----------- End IGroupRTP ----------------------
 
 // ----------- BEGIN IMsgidIndexDB ----------------------
@@ -200,26 +313,54 @@ var ce_ReqUpdateMessageLocation = serializer.StripawayPtrWith(new(ReqUpdateMessa
 
 // ----------- END IMsgidIndexDB ----------------------
 
+// ----------- BEGIN IScrubDB ----------------------
+
+type ReqGetDamagedArticles struct{
+	Group []byte
+	Max   int
+}
+var ce_ReqGetDamagedArticles = serializer.StripawayPtrWith(new(ReqGetDamagedArticles),serializer.WithInline(new(ReqGetDamagedArticles)).
+	Field("Group").
+	Field("Max"))
+//
+
+// ----------- END IScrubDB ----------------------
+
 
 
 var ce_RequestData = serializer.Switch(0).
 	AddTypeWith(0x01,new(ReqPutArticle),ce_ReqPutArticle).
 	AddTypeWith(0x02,new(ReqGetArticle),ce_ReqGetArticle).
 	AddTypeWith(0x03,new(ReqGetXover  ),ce_ReqGetXover).
+	AddTypeWith(0x04,new(ReqGetArticleNumbers),ce_ReqGetArticleNumbers).
 
 	AddTypeWith(0x11,new(ReqDayfileNodeInfo),ce_ReqDayfileNodeInfo).
 	AddTypeWith(0x12,new(ReqAddDayfileBlob),ce_ReqAddDayfileBlob).
 	AddTypeWith(0x13,new(ReqReadDayfileBlob),ce_ReqReadDayfileBlob).
+	AddTypeWith(0x14,new(ReqAddDayfileBlobAt),ce_ReqAddDayfileBlobAt).
 
 	AddTypeWith(0x21,new(ReqGetGroupNRT),ce_ReqGetGroupNRT).
 	AddTypeWith(0x22,new(ReqGetGroupBulkNRT),ce_ReqGetGroupBulkNRT).
 	AddTypeWith(0x23,new(ReqPutGroupNRT),ce_ReqPutGroupNRT).
 	AddTypeWith(0x24,new(ReqGetGroupsNRT),ce_ReqGetGroupsNRT).
+	AddTypeWith(0x25,new(ReqGetGroupsWildmatNRT),ce_ReqGetGroupsWildmatNRT).
+	AddTypeWith(0x26,new(ReqDigestNRT),ce_ReqDigestNRT).
+	AddTypeWith(0x27,new(ReqExportRangeNRT),ce_ReqExportRangeNRT).
+	AddTypeWith(0x28,new(ReqListGroupsCreatedSince),ce_ReqListGroupsCreatedSince).
+	AddTypeWith(0x29,new(ReqGetGroupsActive),ce_ReqGetGroupsActive).
+	AddTypeWith(0x2A,new(ReqGetGroupsPageNRT),ce_ReqGetGroupsPageNRT).
+	AddTypeWith(0x2B,new(ReqGetGroupNRTv1),ce_ReqGetGroupNRTv1).
+	AddTypeWith(0x2C,new(ReqGetGroupBulkNRTv1),ce_ReqGetGroupBulkNRTv1).
+	AddTypeWith(0x2D,new(ReqPutGroupNRTv1),ce_ReqPutGroupNRTv1).
+	AddTypeWith(0x2E,new(ReqGetGroupsNRTv1),ce_ReqGetGroupsNRTv1).
 
 	AddTypeWith(0x30,new(ReqGroupRTP),ce_ReqGroupRTP).
+	AddTypeContainerWith(0x31,[]groupsdb.GroupPairRTP{},groupsdb.CeGroupPairRTP()).
 
 	AddTypeWith(0x41,new(ReqGetMessageLocation),ce_ReqGetMessageLocation).
-	AddTypeWith(0x42,new(ReqUpdateMessageLocation),ce_ReqUpdateMessageLocation)
+	AddTypeWith(0x42,new(ReqUpdateMessageLocation),ce_ReqUpdateMessageLocation).
+
+	AddTypeWith(0x51,new(ReqGetDamagedArticles),ce_ReqGetDamagedArticles)
 //
 
 
@@ -252,6 +393,13 @@ var ce_RespGetArticle = serializer.StripawayPtrWith(new(RespGetArticle),serializ
 	Field("Ok"))
 //
 
+type RespArticleNumbers struct{
+	Numbers []int64
+}
+var ce_RespArticleNumbers = serializer.StripawayPtrWith(new(RespArticleNumbers),serializer.WithInline(new(RespArticleNumbers)).
+	Field("Numbers"))
+//
+
 // ----------- END IGrpArtDB ----------------------
 
 // ----------- BEGIN IDayfileNode ----------------------
@@ -280,6 +428,61 @@ type RespPutGroupNRT struct{
 var ce_RespPutGroupNRT = serializer.StripawayPtrWith(new(RespPutGroupNRT),serializer.WithInline(new(RespPutGroupNRT)).
 	FieldWith("Other",groupsdb.CeGroupEntryNRT()).
 	Field("Ok"))
+
+// Responses including Alias, see ReqGetGroupNRTv1.
+type RespGroupNRTv1 struct{
+	Entry *groupsdb.GroupEntryNRT
+}
+var ce_RespGroupNRTv1 = serializer.StripawayPtrWith(new(RespGroupNRTv1),serializer.WithInline(new(RespGroupNRTv1)).
+	FieldWith("Entry",groupsdb.CeGroupEntryNRTv1()))
+
+type RespPutGroupNRTv1 RespPutGroupNRT
+var ce_RespPutGroupNRTv1 = serializer.StripawayPtrWith(new(RespPutGroupNRTv1),serializer.WithInline(new(RespPutGroupNRTv1)).
+	FieldWith("Other",groupsdb.CeGroupEntryNRTv1()).
+	Field("Ok"))
+
+type RespGroupsNRTv1 []groupsdb.GroupPairNRT
+
+// An incomplete page of groups, sent instead of RespGroupsNRTv1.
+type RespGroupsTruncated struct{
+	Resume  []byte      // The resume marker.
+	Entries interface{} // RespGroupsNRTv1
+}
+var ce_groupsPage = serializer.Switch(0).
+	AddTypeContainerWith(0x27,RespGroupsNRTv1{},groupsdb.CeGroupPairNRTv1())
+var ce_RespGroupsTruncated = serializer.StripawayPtrWith(new(RespGroupsTruncated),serializer.WithInline(new(RespGroupsTruncated)).
+	Field("Resume").
+	FieldWith("Entries",ce_groupsPage))
+
+// An incomplete active listing, sent instead of []groupsdb.GroupActive.
+type RespActiveTruncated struct{
+	Resume  []byte      // The resume marker.
+	Entries interface{} // []groupsdb.GroupActive
+}
+var ce_activePage = serializer.Switch(0).
+	AddTypeContainerWith(0x25,[]groupsdb.GroupActive{},groupsdb.CeGroupActive())
+var ce_RespActiveTruncated = serializer.StripawayPtrWith(new(RespActiveTruncated),serializer.WithInline(new(RespActiveTruncated)).
+	Field("Resume").
+	FieldWith("Entries",ce_activePage))
+
+func respGroupsPage(entries []groupsdb.GroupPairNRT, resume []byte) interface{} {
+	if resume!=nil { return &RespGroupsTruncated{resume,RespGroupsNRTv1(entries)} }
+	return RespGroupsNRTv1(entries)
+}
+func parseGroupsPage(data interface{}) (entries []groupsdb.GroupPairNRT, resume []byte, err error) {
+	switch v := data.(type) {
+	case RespGroupsNRTv1:
+		entries = v
+	case *RespGroupsTruncated:
+		page,ok := v.Entries.(RespGroupsNRTv1)
+		if !ok { return nil,nil,ENoResponse }
+		entries = page
+		resume = append([]byte{},v.Resume...)
+	default:
+		err = ENoResponse
+	}
+	return
+}
 // ----------- END IGroupNRT ----------------------
 
 // ----------- BEGIN IGroupRTP ----------------------
@@ -295,12 +498,21 @@ type RespRollbackArticleRTP struct{
 }
 var ce_RespRollbackArticleRTP = serializer.StripawayPtrWith(new(RespRollbackArticleRTP),serializer.WithInline(new(RespRollbackArticleRTP)).
 	Field("Ok"))
+
+type RespIncrementRTPBy struct{
+	First int64
+	Last  int64
+	Ok Boolean
+}
+var ce_RespIncrementRTPBy = serializer.StripawayPtrWith(new(RespIncrementRTPBy),serializer.WithInline(new(RespIncrementRTPBy)).
+	Field("First").Field("Last").Field("Ok"))
 // ----------- END IGroupRTP ----------------------
 
 var ce_ResponseData = serializer.Switch(0).
 	AddTypeWith          (0x01,new(RespPutArticle),ce_RespPutArticle).
 	AddTypeWith          (0x02,new(RespGetArticle),ce_RespGetArticle).
 	AddTypeContainerWithP(0x03,new([]messagedb.XoverElement),messagedb.CeXoverElement()).
+	AddTypeWith          (0x04,new(RespArticleNumbers),ce_RespArticleNumbers).
 
 	AddTypeWith          (0x11,new(RespFreeDayfileStorage),ce_RespFreeDayfileStorage).
 	AddTypeWith          (0x12,new(RespDayfileBlob),ce_RespDayfileBlob).
@@ -309,12 +521,23 @@ var ce_ResponseData = serializer.Switch(0).
 	AddTypeWith          (0x21,new(groupsdb.GroupEntryNRT),groupsdb.CeGroupEntryNRT()).
 	AddTypeContainerWith (0x22,[]groupsdb.GroupPairNRT{},groupsdb.CeGroupPairNRT()).
 	AddTypeWith          (0x23,new(RespPutGroupNRT),ce_RespPutGroupNRT).
+	AddTypeContainerWith (0x24,[]groupsdb.GroupDigest{},groupsdb.CeGroupDigest()).
+	AddTypeContainerWith (0x25,[]groupsdb.GroupActive{},groupsdb.CeGroupActive()).
+	AddTypeWith          (0x26,new(RespGroupsTruncated),ce_RespGroupsTruncated).
+	AddTypeContainerWith (0x27,RespGroupsNRTv1{},groupsdb.CeGroupPairNRTv1()).
+	AddTypeWith          (0x28,new(RespGroupNRTv1),ce_RespGroupNRTv1).
+	AddTypeWith          (0x29,new(RespPutGroupNRTv1),ce_RespPutGroupNRTv1).
+	AddTypeWith          (0x2A,new(RespActiveTruncated),ce_RespActiveTruncated).
 
 	AddTypeWith          (0x31,new(groupsdb.GroupEntryRTP),groupsdb.CeGroupEntryRTP()).
 	AddTypeWith          (0x32,new(RespIncrementRTP),ce_RespIncrementRTP).
 	AddTypeWith          (0x33,new(RespRollbackArticleRTP),ce_RespRollbackArticleRTP).
+	AddTypeWith          (0x34,new(RespIncrementRTPBy),ce_RespIncrementRTPBy).
+	AddTypeContainerWith (0x35,[]groupsdb.GroupPairRTP{},groupsdb.CeGroupPairRTP()).
 	
-	AddTypeWith          (0x41,new(messagedb.ArticleRedirect),messagedb.CeArticleRedirectPtr())
+	AddTypeWith          (0x41,new(messagedb.ArticleRedirect),messagedb.CeArticleRedirectPtr()).
+	
+	AddTypeContainerWith (0x51,[]messagedb.ScrubDamage{},messagedb.CeScrubDamage())
 //
 
 
@@ -332,8 +555,11 @@ type Handler struct{
 	MessageDB messagedb.IGrpArtDB
 	DayfileDB messagedb.IDayfileNode
 	GroupsNRT groupsdb.IGroupNRT
+	GroupSync groupsdb.IGroupSyncNRT
+	Active    groupsdb.IGroupActive
 	GroupsRTP groupsdb.IGroupRTP
 	MessageID messagedb.IMsgidIndexDB
+	Scrub     messagedb.IScrubDB
 }
 func (h *Handler) Create() fastrpc.HandlerCtx { return new(HandlerCtx) }
 func (h *Handler) Handler(ctx fastrpc.HandlerCtx) (ctx0 fastrpc.HandlerCtx) {
@@ -355,6 +581,9 @@ func (h *Handler) Handler(ctx fastrpc.HandlerCtx) (ctx0 fastrpc.HandlerCtx) {
 	case *ReqGetXover:
 		if h.MessageDB==nil { return }
 		hctx.Resp.Data = h.MessageDB.GetXover(v.Group, v.First, v.Last, v.Max)
+	case *ReqGetArticleNumbers:
+		if h.MessageDB==nil { return }
+		hctx.Resp.Data = &RespArticleNumbers{h.MessageDB.GetArticleNumbers(v.Group)}
 	
 	// -----------  messagedb.IDayfileNode -------------
 	case *ReqDayfileNodeInfo:
@@ -369,6 +598,10 @@ func (h *Handler) Handler(ctx fastrpc.HandlerCtx) (ctx0 fastrpc.HandlerCtx) {
 		if h.DayfileDB==nil { return }
 		hctx.Resp.Data = &RespDayfileBlob{h.DayfileDB.AddDayfileBlob(v.DayID,v.Comp,v.Data)}
 		
+	case *ReqAddDayfileBlobAt:
+		if h.DayfileDB==nil { return }
+		hctx.Resp.Data = &RespDayfileBlob{h.DayfileDB.AddDayfileBlobAt(v.TimeStamp,v.Comp,v.Data)}
+		
 	case *ReqReadDayfileBlob:
 		if h.DayfileDB==nil { return }
 		hctx.Resp.Data = &RespDayfileBlob{h.DayfileDB.ReadDayfileBlob(v.Data)}
@@ -383,10 +616,57 @@ func (h *Handler) Handler(ctx fastrpc.HandlerCtx) (ctx0 fastrpc.HandlerCtx) {
 	case *ReqGetGroupsNRT:
 		if h.GroupsNRT==nil { return }
 		hctx.Resp.Data = h.GroupsNRT.GetGroupsNRT( v.After,v.Prefix,v.Suffix )
+	case *ReqGetGroupNRTv1:
+		if h.GroupsNRT==nil { return }
+		hctx.Resp.Data = &RespGroupNRTv1{ h.GroupsNRT.GetGroupNRT(v.Group) }
+	case *ReqGetGroupBulkNRTv1:
+		if h.GroupsNRT==nil { return }
+		hctx.Resp.Data = RespGroupsNRTv1(h.GroupsNRT.GetGroupBulkNRT(v.Groups))
+	case *ReqGetGroupsNRTv1:
+		if h.GroupsNRT==nil { return }
+		hctx.Resp.Data = RespGroupsNRTv1(h.GroupsNRT.GetGroupsNRT( v.After,v.Prefix,v.Suffix ))
+	case *ReqGetGroupsPageNRT:
+		if h.GroupsNRT==nil { return }
+		entries,resume,err := h.GroupsNRT.GetGroupsPageNRT( v.After,v.Prefix,v.Suffix,v.Limit )
+		if err!=nil { return }
+		hctx.Resp.Data = respGroupsPage(entries,resume)
+	case *ReqGetGroupsWildmatNRT:
+		if h.GroupsNRT==nil { return }
+		entries,resume,err := h.GroupsNRT.GetGroupsWildmatNRT( v.After,v.Wildmat,v.Limit )
+		if err!=nil { return }
+		hctx.Resp.Data = respGroupsPage(entries,resume)
+	case *ReqListGroupsCreatedSince:
+		if h.GroupsNRT==nil { return }
+		entries,resume,err := h.GroupsNRT.ListGroupsCreatedSince( v.TimeStamp,v.Wildmat,v.After,v.Limit )
+		if err!=nil { return }
+		hctx.Resp.Data = respGroupsPage(entries,resume)
+	case *ReqGetGroupsActive:
+		if h.Active==nil { return }
+		entries,resume,err := h.Active.GetGroupsActive( v.Wildmat,v.After,v.Limit )
+		if err!=nil { return }
+		if resume!=nil {
+			hctx.Resp.Data = &RespActiveTruncated{resume,entries}
+		} else {
+			hctx.Resp.Data = entries
+		}
+	case *ReqDigestNRT:
+		if h.GroupSync==nil { return }
+		digests,err := h.GroupSync.DigestNRT(v.Prefix)
+		if err!=nil { return }
+		hctx.Resp.Data = digests
+	case *ReqExportRangeNRT:
+		if h.GroupSync==nil { return }
+		entries,err := h.GroupSync.ExportRangeNRT(v.From,v.To)
+		if err!=nil { return }
+		hctx.Resp.Data = RespGroupsNRTv1(entries)
 	case *ReqPutGroupNRT:
 		if h.GroupsNRT==nil || v.Entry==nil { return }
 		grpnrte, ok := h.GroupsNRT.PutGroupNRT(v.Group, v.Entry)
 		hctx.Resp.Data = &RespPutGroupNRT{ grpnrte, ToBoolean(ok) }
+	case *ReqPutGroupNRTv1:
+		if h.GroupsNRT==nil || v.Entry==nil { return }
+		grpnrte, ok := h.GroupsNRT.PutGroupNRT(v.Group, v.Entry)
+		hctx.Resp.Data = &RespPutGroupNRTv1{ grpnrte, ToBoolean(ok) }
 	
 	// -----------  groupsdb.IGroupRTP -------------
 	case *ReqGroupRTP:
@@ -400,7 +680,24 @@ func (h *Handler) Handler(ctx fastrpc.HandlerCtx) (ctx0 fastrpc.HandlerCtx) {
 		case RTP_RollbackArticleRTP:
 			hctx.Resp.Data = &RespRollbackArticleRTP{
 				ToBoolean(h.GroupsRTP.RollbackArticleRTP(v.Group,v.Artnum))}
+		case RTP_IncrementRTPBy:
+			first, last, ok := h.GroupsRTP.IncrementRTPBy(v.Group,v.Artnum)
+			hctx.Resp.Data = &RespIncrementRTPBy{ first, last, ToBoolean(ok) }
+		case RTP_RecomputeRTP:
+			hctx.Resp.Data = h.GroupsRTP.RecomputeRTP(v.Group)
 		}
+	case []groupsdb.GroupPairRTP:
+		if h.GroupsRTP==nil { return }
+		counts := make(map[string]int64,len(v))
+		for _,p := range v { counts[string(p.Key)] = p.Value.Count }
+		first, ok := h.GroupsRTP.AllocateNumbers(counts)
+		if !ok { return }
+		resp := make([]groupsdb.GroupPairRTP,0,len(first))
+		for group,f := range first {
+			n := counts[group]
+			resp = append(resp,groupsdb.GroupPairRTP{[]byte(group),groupsdb.GroupEntryRTP{n,f,f+n-1}})
+		}
+		hctx.Resp.Data = resp
 	// -----------  messagedb.IMsgidIndexDB -------------
 	case *ReqGetMessageLocation:
 		if h.MessageID==nil { return }
@@ -409,6 +706,10 @@ func (h *Handler) Handler(ctx fastrpc.HandlerCtx) (ctx0 fastrpc.HandlerCtx) {
 		if h.MessageID==nil { return }
 		hctx.Resp.Data = &RespRollbackArticleRTP{ // Reuse datatype
 			ToBoolean(h.MessageID.UpdateMessageLocation(v.MessageID,v.ArticlePos,v.Timestamp))}
+	// -----------  messagedb.IScrubDB -------------
+	case *ReqGetDamagedArticles:
+		if h.Scrub==nil { return }
+		hctx.Resp.Data = h.Scrub.GetDamagedArticles(v.Group,v.Max)
 	}
 	return
 }
@@ -418,6 +719,12 @@ type Client struct{
 	Client  *fastrpc.Client
 	Timeout time.Duration
 	Write   time.Duration
+	
+	// If set, the group requests including GroupEntryNRT.Alias are used.
+	// Otherwise the original ones are used, which every server understands,
+	// but which lose aliases on the way. Only set it, once all servers have
+	// been upgraded.
+	Alias   bool
 }
 
 func(c *Client) Initialize() error {
@@ -464,6 +771,17 @@ func(c *Client) GetXover(group []byte, first, last int64, max int) (result []mes
 	return respo
 }
 
+func(c *Client) GetArticleNumbers(group []byte) (nums []int64) {
+	req := new(Request)
+	resp := new(Response)
+	req.Data = &ReqGetArticleNumbers{group}
+	err := c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout) )
+	if err!=nil { return }
+	respo,_ := resp.Data.(*RespArticleNumbers)
+	if respo==nil { return }
+	return respo.Numbers
+}
+
 // -----------  messagedb.IDayfileNode -------------
 
 func(c *Client) GetDayfileNodeID() *uuid.UUID {
@@ -495,6 +813,16 @@ func(c *Client) AddDayfileBlob(dayid int, ch messagedb.CompressionHint, b messag
 	if respo==nil { return nil }
 	return respo.Data
 }
+func(c *Client) AddDayfileBlobAt(ts int64, ch messagedb.CompressionHint, b messagedb.AbstractBlob) messagedb.AbstractBlob {
+	req := new(Request)
+	resp := new(Response)
+	req.Data = &ReqAddDayfileBlobAt{ts,ch,b}
+	err := c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout+c.Write) )
+	if err!=nil { return nil }
+	respo,_ := resp.Data.(*RespDayfileBlob)
+	if respo==nil { return nil }
+	return respo.Data
+}
 func(c *Client) ReadDayfileBlob(b messagedb.AbstractBlob) messagedb.AbstractBlob {
 	req := new(Request)
 	resp := new(Response)
@@ -507,44 +835,141 @@ func(c *Client) ReadDayfileBlob(b messagedb.AbstractBlob) messagedb.AbstractBlob
 
 // -----------  groupsdb.IGroupNRT -------------
 
+// Accepts both versions of a group list.
+func groupsNRT(data interface{}) (entries []groupsdb.GroupPairNRT, ok bool) {
+	switch v := data.(type) {
+	case []groupsdb.GroupPairNRT: return v,true
+	case RespGroupsNRTv1: return []groupsdb.GroupPairNRT(v),true
+	}
+	return nil,false
+}
+
 func(c *Client) GetGroupNRT(group []byte) (entry *groupsdb.GroupEntryNRT) {
 	req := new(Request)
 	resp := new(Response)
-	req.Data = &ReqGetGroupNRT{group}
+	if c.Alias {
+		req.Data = &ReqGetGroupNRTv1{group}
+	} else {
+		req.Data = &ReqGetGroupNRT{group}
+	}
 	err := c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout) )
 	if err!=nil { return }
-	entry,_ = resp.Data.(*groupsdb.GroupEntryNRT)
+	switch v := resp.Data.(type) {
+	case *groupsdb.GroupEntryNRT: entry = v
+	case *RespGroupNRTv1: entry = v.Entry
+	}
 	return
 }
 func(c *Client) GetGroupBulkNRT(groups [][]byte) (entries []groupsdb.GroupPairNRT) {
 	req := new(Request)
 	resp := new(Response)
-	req.Data = &ReqGetGroupBulkNRT{groups}
+	if c.Alias {
+		req.Data = &ReqGetGroupBulkNRTv1{groups}
+	} else {
+		req.Data = &ReqGetGroupBulkNRT{groups}
+	}
 	err := c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout) )
 	if err!=nil { return }
-	entries,_ = resp.Data.([]groupsdb.GroupPairNRT)
+	entries,_ = groupsNRT(resp.Data)
 	return
 }
 func(c *Client) GetGroupsNRT(after, prefix, suffix []byte) (entries []groupsdb.GroupPairNRT) {
 	req := new(Request)
 	resp := new(Response)
-	req.Data = &ReqGetGroupsNRT{after,prefix, suffix}
+	if c.Alias {
+		req.Data = &ReqGetGroupsNRTv1{after,prefix, suffix}
+	} else {
+		req.Data = &ReqGetGroupsNRT{after,prefix, suffix}
+	}
 	err := c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout) )
 	if err!=nil { return }
-	entries,_ = resp.Data.([]groupsdb.GroupPairNRT)
+	entries,_ = groupsNRT(resp.Data)
 	return
 }
+func(c *Client) GetGroupsPageNRT(after, prefix, suffix []byte, limit int) (entries []groupsdb.GroupPairNRT, resume []byte, err error) {
+	req := new(Request)
+	resp := new(Response)
+	req.Data = &ReqGetGroupsPageNRT{after,prefix,suffix,limit}
+	err = c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout) )
+	if err!=nil { return }
+	return parseGroupsPage(resp.Data)
+}
+func(c *Client) GetGroupsWildmatNRT(after, wildmat []byte, limit int) (entries []groupsdb.GroupPairNRT, resume []byte, err error) {
+	req := new(Request)
+	resp := new(Response)
+	req.Data = &ReqGetGroupsWildmatNRT{after,wildmat,limit}
+	err = c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout) )
+	if err!=nil { return }
+	return parseGroupsPage(resp.Data)
+}
 func(c *Client) PutGroupNRT(group []byte, entry *groupsdb.GroupEntryNRT) (other *groupsdb.GroupEntryNRT, ok bool) {
 	req := new(Request)
 	resp := new(Response)
-	req.Data = &ReqPutGroupNRT{group, entry}
+	if c.Alias {
+		req.Data = &ReqPutGroupNRTv1{group, entry}
+	} else {
+		req.Data = &ReqPutGroupNRT{group, entry}
+	}
 	err := c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout+c.Write) )
 	if err!=nil { return }
-	respo, _ := resp.Data.(*RespPutGroupNRT)
-	if respo==nil { return }
-	return respo.Other, respo.Ok.Bool()
+	switch v := resp.Data.(type) {
+	case *RespPutGroupNRT: return v.Other, v.Ok.Bool()
+	case *RespPutGroupNRTv1: return v.Other, v.Ok.Bool()
+	}
+	return
 }
 
+func(c *Client) ListGroupsCreatedSince(ts int64, wildmat, after []byte, limit int) (entries []groupsdb.GroupPairNRT, resume []byte, err error) {
+	req := new(Request)
+	resp := new(Response)
+	req.Data = &ReqListGroupsCreatedSince{ts,wildmat,after,limit}
+	err = c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout) )
+	if err!=nil { return }
+	return parseGroupsPage(resp.Data)
+}
+func(c *Client) GetGroupsActive(wildmat, after []byte, limit int) (entries []groupsdb.GroupActive, resume []byte, err error) {
+	req := new(Request)
+	resp := new(Response)
+	req.Data = &ReqGetGroupsActive{wildmat,after,limit}
+	err = c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout) )
+	if err!=nil { return }
+	switch v := resp.Data.(type) {
+	case []groupsdb.GroupActive:
+		entries = v
+	case *RespActiveTruncated:
+		page,ok := v.Entries.([]groupsdb.GroupActive)
+		if !ok { return nil,nil,ENoResponse }
+		entries = page
+		resume = append([]byte{},v.Resume...)
+	default:
+		err = ENoResponse
+	}
+	return
+}
+func(c *Client) DigestNRT(prefix []byte) (digests []groupsdb.GroupDigest, err error) {
+	req := new(Request)
+	resp := new(Response)
+	req.Data = &ReqDigestNRT{prefix}
+	err = c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout) )
+	if err!=nil { return }
+	digests,ok := resp.Data.([]groupsdb.GroupDigest)
+	if !ok { err = ENoResponse }
+	return
+}
+func(c *Client) ExportRangeNRT(from, to []byte) (entries []groupsdb.GroupPairNRT, err error) {
+	req := new(Request)
+	resp := new(Response)
+	req.Data = &ReqExportRangeNRT{from,to}
+	err = c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout) )
+	if err!=nil { return }
+	entries,ok := groupsNRT(resp.Data)
+	if !ok { err = ENoResponse }
+	return
+}
+func(c *Client) RemoveGroupNRT(group []byte, ts int64) (ok bool) {
+	_,ok = c.PutGroupNRT(group,&groupsdb.GroupEntryNRT{Status:groupsdb.StatusTombstone,TimeStamp:ts})
+	return
+}
 
 // -----------  groupsdb.IGroupRTP -------------
 
@@ -567,6 +992,39 @@ func(c *Client) IncrementRTP(group []byte) (artnum int64, ok bool) {
 	if respo==nil { return }
 	return respo.Artnum,respo.Ok.Bool()
 }
+func(c *Client) IncrementRTPBy(group []byte, n int64) (first, last int64, ok bool) {
+	req := new(Request)
+	resp := new(Response)
+	req.Data = &ReqGroupRTP{RTP_IncrementRTPBy,group,n}
+	err := c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout+c.Write) )
+	if err!=nil { return }
+	respo,_ := resp.Data.(*RespIncrementRTPBy)
+	if respo==nil { return }
+	return respo.First,respo.Last,respo.Ok.Bool()
+}
+func(c *Client) AllocateNumbers(counts map[string]int64) (first map[string]int64, ok bool) {
+	req := new(Request)
+	resp := new(Response)
+	reqo := make([]groupsdb.GroupPairRTP,0,len(counts))
+	for group,n := range counts { reqo = append(reqo,groupsdb.GroupPairRTP{Key:[]byte(group),Value:groupsdb.GroupEntryRTP{Count:n}}) }
+	req.Data = reqo
+	err := c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout+c.Write) )
+	if err!=nil { return }
+	respo,ok := resp.Data.([]groupsdb.GroupPairRTP)
+	if !ok { return }
+	first = make(map[string]int64,len(respo))
+	for _,p := range respo { first[string(p.Key)] = p.Value.Low }
+	return
+}
+func(c *Client) RecomputeRTP(group []byte) (entry *groupsdb.GroupEntryRTP) {
+	req := new(Request)
+	resp := new(Response)
+	req.Data = &ReqGroupRTP{RTP_RecomputeRTP,group,0}
+	err := c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout+c.Write) )
+	if err!=nil { return }
+	entry,_ = resp.Data.(*groupsdb.GroupEntryRTP)
+	return
+}
 func(c *Client) RollbackArticleRTP(group []byte, artnum int64) (ok bool) {
 	req := new(Request)
 	resp := new(Response)
@@ -601,4 +1059,14 @@ func(c *Client) UpdateMessageLocation(messageID []byte,articlePos *messagedb.Art
 	return respo.Ok.Bool()
 }
 
+// -----------  messagedb.IScrubDB -------------
 
+func(c *Client) GetDamagedArticles(group []byte, max int) (result []messagedb.ScrubDamage) {
+	req := new(Request)
+	resp := new(Response)
+	req.Data = &ReqGetDamagedArticles{group,max}
+	err := c.Client.DoDeadline(req, resp, time.Now().Add(c.Timeout) )
+	if err!=nil { return }
+	result,_ = resp.Data.([]messagedb.ScrubDamage)
+	return
+}
@@ -0,0 +1,93 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package groupsdb
+
+import "github.com/byte-mug/golibs/serializer"
+import "github.com/boltdb/bolt"
+import "bytes"
+import "time"
+
+// A line of the active listing: the status of a group, joined with its
+// article numbers.
+type GroupActive struct{
+	Group  []byte
+	Count  int64
+	Low    int64
+	High   int64
+	Status byte
+	Alias  []byte
+}
+
+var ce_GroupActive = serializer.WithInline(new(GroupActive)).
+	Field("Group").
+	Field("Count").
+	Field("Low").
+	Field("High").
+	Field("Status").
+	Field("Alias")
+//
+
+func CeGroupActive() serializer.CodecElement { return ce_GroupActive }
+
+type IGroupActive interface{
+	GetGroupsActive(wildmat, after []byte, limit int) (entries []GroupActive, resume []byte, err error)
+}
+
+// Returns up to limit groups after the group after, that match the wildmat
+// (or all, if it is empty), joined with their GRP.RTP entries in one
+// transaction. This requires GroupRTP to use the same database. Like
+// GetGroupsPageNRT, it returns a resume marker, if the listing is incomplete.
+func (g *GroupNRT) GetGroupsActive(wildmat, after []byte, limit int) (entries []GroupActive, resume []byte, err error) {
+	w := ParseWildmat(wildmat)
+	prefix := w.Prefix()
+	tmo := time.After(g.Timeout)
+	err = g.DB.View(func(tx *bolt.Tx) error {
+		rtp := tx.Bucket(tGroupRTP)
+		c := tx.Bucket(tGroupNRT).Cursor()
+		k,v := seekAfter(c,after,prefix)
+		var je *GroupEntryNRT
+		resume = scanPage(c,k,v,limit,tmo,
+			func(k []byte) bool { return bytes.HasPrefix(k,prefix) },
+			func(k, v []byte) bool {
+				if len(wildmat)>0 && !w.Match(k) { return false }
+				var err error
+				je,err = ParseGroupEntryNRT(v)
+				return err==nil && !je.IsTombstone()
+			},
+			func(k, v []byte) {
+				ga := GroupActive{Group:cloneb(k),Status:je.Status,Alias:je.Alias}
+				if ga.Status==0 { ga.Status = StatusPosting }
+				if rtp!=nil {
+					if re,err := ParseGroupEntryRTP(rtp.Get(k)); err==nil && re!=nil {
+						ga.Count,ga.Low,ga.High = re.Count,re.Low,re.High
+					}
+				}
+				entries = append(entries,ga)
+			})
+		return nil
+	})
+	return
+}
@@ -0,0 +1,66 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package groupsdb
+
+import "reflect"
+import "testing"
+
+func TestGroupsActiveResume(t *testing.T) {
+	g := newTestGroups(t,testGroups,"alt.c")
+	rtp := &GroupRTP{DB:g.DB}
+	if err := rtp.Initialize(); err!=nil { t.Fatal(err) }
+	rtp.IncrementRTPBy([]byte("comp.a"),3)
+	
+	tests := []struct{
+		wildmat string
+		limit   int
+		want    [][]string
+	}{
+		{"",0,[][]string{{"alt.a","alt.b","comp.a","comp.b","misc.a"}}},
+		{"",5,[][]string{{"alt.a","alt.b","comp.a","comp.b","misc.a"}}},
+		{"",2,[][]string{{"alt.a","alt.b"},{"comp.a","comp.b"},{"misc.a"}}},
+		{"alt.*",2,[][]string{{"alt.a","alt.b"}}},
+		{"*.a",1,[][]string{{"alt.a"},{"comp.a"},{"misc.a"}}},
+	}
+	for _,tt := range tests {
+		var got [][]string
+		var after []byte
+		for i := 0; ; i++ {
+			if i>10 { t.Fatal("no progress") }
+			entries,resume,err := g.GetGroupsActive([]byte(tt.wildmat),after,tt.limit)
+			if err!=nil { t.Fatal(err) }
+			var page []string
+			for _,e := range entries {
+				page = append(page,string(e.Group))
+				if string(e.Group)=="comp.a" && (e.Count!=3 || e.Low!=1 || e.High!=3) { t.Errorf("comp.a = %+v",e) }
+			}
+			got = append(got,page)
+			if resume==nil { break }
+			after = resume
+		}
+		if !reflect.DeepEqual(got,tt.want) { t.Errorf("%q/%d: got %q, want %q",tt.wildmat,tt.limit,got,tt.want) }
+	}
+}
@@ -0,0 +1,104 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package groupsdb
+
+import "github.com/boltdb/bolt"
+import "time"
+
+// Creation times of groups: GRP.NRT.CREATED maps the group to its creation
+// time, GRP.NRT.BYCTIME holds creation time + group, ordered by time.
+var tGroupCreated = []byte("GRP.NRT.CREATED")
+var tGroupByCTime = []byte("GRP.NRT.BYCTIME")
+
+func ctimeKey(ts int64, group []byte) []byte {
+	return append(encodeNum(ts),group...)
+}
+
+// Initializes the creation times of existing groups. Their TimeStamp is the
+// time of the last update, not of the creation, so the epoch is used instead:
+// groups, that predate the index, are never reported as new.
+func backfillCreated(tx *bolt.Tx) error {
+	c := tx.Bucket(tGroupNRT).Cursor()
+	for k,v := c.First(); len(k)>0; k,v = c.Next() {
+		je,err := ParseGroupEntryNRT(v)
+		if err!=nil || je.IsTombstone() { continue }
+		if err := setCreated(tx,k,0); err!=nil { return err }
+	}
+	return nil
+}
+
+func setCreated(tx *bolt.Tx, group []byte, ts int64) error {
+	if err := clearCreated(tx,group); err!=nil { return err }
+	if err := tx.Bucket(tGroupCreated).Put(group,encodeNum(ts)); err!=nil { return err }
+	return tx.Bucket(tGroupByCTime).Put(ctimeKey(ts,group),[]byte{})
+}
+
+func clearCreated(tx *bolt.Tx, group []byte) error {
+	bkt := tx.Bucket(tGroupCreated)
+	old := bkt.Get(group)
+	if old==nil { return nil }
+	if err := tx.Bucket(tGroupByCTime).Delete(ctimeKey(decodeNum(old),group)); err!=nil { return err }
+	return bkt.Delete(group)
+}
+
+// Maintains the creation time, after the entry of group has been replaced.
+// A group is created, if it did not exist or was a tombstone before.
+func updateCreated(tx *bolt.Tx, group []byte, old, entry *GroupEntryNRT) error {
+	switch {
+	case entry.IsTombstone():
+		return clearCreated(tx,group)
+	case old==nil || old.IsTombstone():
+		return setCreated(tx,group,entry.TimeStamp)
+	}
+	return nil
+}
+
+// Returns the groups, that match the wildmat (or all, if it is empty) and have
+// been created at or after ts (UNIX-format), ordered by creation time, in pages
+// like GetGroupsPageNRT. The resume marker is no group name, but must be passed
+// as after, together with the same ts.
+func (g *GroupNRT) ListGroupsCreatedSince(ts int64, wildmat, after []byte, limit int) (entries []GroupPairNRT, resume []byte, err error) {
+	w := ParseWildmat(wildmat)
+	tmo := time.After(g.Timeout)
+	err = g.DB.View(func(tx *bolt.Tx) error {
+		grps := tx.Bucket(tGroupNRT)
+		c := tx.Bucket(tGroupByCTime).Cursor()
+		k,v := seekAfter(c,after,encodeNum(ts))
+		var je *GroupEntryNRT
+		resume = scanPage(c,k,v,limit,tmo,
+			func(k []byte) bool { return len(k)>8 },
+			func(k, v []byte) bool {
+				group := k[8:]
+				if len(wildmat)>0 && !w.Match(group) { return false }
+				var err error
+				je,err = ParseGroupEntryNRT(grps.Get(group))
+				return err==nil && je!=nil && !je.IsTombstone()
+			},
+			func(k, v []byte) { entries = append(entries,GroupPairNRT{cloneb(k[8:]),*je}) })
+		return nil
+	})
+	return
+}
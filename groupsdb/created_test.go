@@ -0,0 +1,56 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package groupsdb
+
+import "github.com/boltdb/bolt"
+import "reflect"
+import "testing"
+
+// Groups, that predate the creation index, are not reported as new.
+func TestBackfillCreated(t *testing.T) {
+	g := newTestGroups(t,map[string]int64{"old.a":100,"old.b":200})
+	err := g.DB.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(tGroupCreated); err!=nil { return err }
+		return tx.DeleteBucket(tGroupByCTime)
+	})
+	if err!=nil { t.Fatal(err) }
+	if err := g.Initialize(); err!=nil { t.Fatal(err) }
+	g.PutGroupNRT([]byte("new.a"),&GroupEntryNRT{Status:StatusPosting,TimeStamp:150})
+	
+	tests := []struct{
+		ts   int64
+		want []string
+	}{
+		{0,[]string{"old.a","old.b","new.a"}},
+		{1,[]string{"new.a"}},
+		{151,nil},
+	}
+	for _,tt := range tests {
+		entries,resume,err := g.ListGroupsCreatedSince(tt.ts,nil,nil,0)
+		if err!=nil || resume!=nil { t.Fatalf("resume %q, err %v",resume,err) }
+		if got := pairKeys(entries); !reflect.DeepEqual(got,tt.want) { t.Errorf("since %d: got %q, want %q",tt.ts,got,tt.want) }
+	}
+}
@@ -0,0 +1,122 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package groupsdb
+
+import "github.com/byte-mug/golibs/serializer"
+import "github.com/boltdb/bolt"
+import "crypto/sha256"
+import "encoding/binary"
+import "bytes"
+import "hash"
+
+// The digest of all groups below a prefix. DigestNRT(prefix) returns one
+// digest per next byte, and one for the group, that is equal to the prefix.
+// Two nodes, that return equal digests, hold the same groups below Key.
+type GroupDigest struct{
+	Key   []byte
+	Count int64
+	Hash  []byte
+}
+
+var ce_GroupDigest = serializer.WithInline(new(GroupDigest)).
+	Field("Key").
+	Field("Count").
+	Field("Hash")
+//
+
+func CeGroupDigest() serializer.CodecElement { return ce_GroupDigest }
+
+// Anti-entropy interface, used by the Syncer.
+type IGroupSyncNRT interface{
+	DigestNRT(prefix []byte) (digests []GroupDigest, err error)
+	// Returns all entries from <= key < to (or unbounded, if to is empty), including tombstones.
+	ExportRangeNRT(from, to []byte) (entries []GroupPairNRT, err error)
+	PutGroupNRT(group []byte, entry *GroupEntryNRT) (other *GroupEntryNRT,ok bool)
+}
+
+// The first key, that is beyond all keys starting with prefix (nil if there is none).
+func prefixEnd(prefix []byte) []byte {
+	end := cloneb(prefix)
+	for i := len(end)-1; i>=0; i-- {
+		if end[i]<0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+func (g *GroupNRT) DigestNRT(prefix []byte) (digests []GroupDigest, err error) {
+	var h hash.Hash
+	var buf [8]byte
+	put := func(b []byte) {
+		binary.BigEndian.PutUint64(buf[:],uint64(len(b)))
+		h.Write(buf[:])
+		h.Write(b)
+	}
+	err = g.DB.View(func(tx *bolt.Tx) error {
+		var cur *GroupDigest
+		c := tx.Bucket(tGroupNRT).Cursor()
+		k,v := c.Seek(prefix)
+		if len(prefix)==0 { k,v = c.First() }
+		for ; len(k)>0 && bytes.HasPrefix(k,prefix) ; k,v = c.Next() {
+			je,err := ParseGroupEntryNRT(v)
+			if err!=nil { continue }
+			child := k[:len(prefix)]
+			if len(k)>len(prefix) { child = k[:len(prefix)+1] }
+			if cur==nil || !bytes.Equal(cur.Key,child) {
+				if cur!=nil { cur.Hash = h.Sum(nil) }
+				digests = append(digests,GroupDigest{Key:cloneb(child)})
+				cur = &digests[len(digests)-1]
+				h = sha256.New()
+			}
+			// Hash the re-encoded entry, so that the digest does not depend on the stored layout.
+			put(k)
+			put(je.Bytes())
+			cur.Count++
+		}
+		if cur!=nil { cur.Hash = h.Sum(nil) }
+		return nil
+	})
+	return
+}
+
+func (g *GroupNRT) ExportRangeNRT(from, to []byte) (entries []GroupPairNRT, err error) {
+	err = g.DB.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(tGroupNRT).Cursor()
+		k,v := c.Seek(from)
+		if len(from)==0 { k,v = c.First() }
+		for ; len(k)>0 ; k,v = c.Next() {
+			if len(to)>0 && bytes.Compare(k,to)>=0 { break }
+			je,err := ParseGroupEntryNRT(v)
+			if err!=nil { continue }
+			entries = append(entries,GroupPairNRT{cloneb(k),*je})
+		}
+		return nil
+	})
+	return
+}
+
@@ -34,7 +34,11 @@ type IGroupNRT interface{
 	GetGroupNRT(group []byte) (entry *GroupEntryNRT)
 	GetGroupBulkNRT(groups [][]byte) (entries []GroupPairNRT)
 	GetGroupsNRT(after, prefix, suffix []byte) (entries []GroupPairNRT)
+	GetGroupsPageNRT(after, prefix, suffix []byte, limit int) (entries []GroupPairNRT, resume []byte, err error)
+	GetGroupsWildmatNRT(after, wildmat []byte, limit int) (entries []GroupPairNRT, resume []byte, err error)
 	PutGroupNRT(group []byte, entry *GroupEntryNRT) (other *GroupEntryNRT,ok bool)
+	RemoveGroupNRT(group []byte, ts int64) (ok bool)
+	ListGroupsCreatedSince(ts int64, wildmat, after []byte, limit int) (entries []GroupPairNRT, resume []byte, err error)
 }
 
 var tGroupNRT = []byte("GRP.NRT")
@@ -48,6 +52,11 @@ func (g *GroupNRT) Initialize() error {
 	}
 	return g.DB.Update(func(tx *bolt.Tx) error {
 		tx.CreateBucketIfNotExists(tGroupNRT)
+		if tx.Bucket(tGroupCreated)==nil {
+			tx.CreateBucketIfNotExists(tGroupCreated)
+			tx.CreateBucketIfNotExists(tGroupByCTime)
+			return backfillCreated(tx)
+		}
 		return nil
 	})
 }
@@ -55,7 +64,7 @@ func (g *GroupNRT) GetGroupNRT(group []byte) (entry *GroupEntryNRT) {
 	g.DB.View(func(tx *bolt.Tx) error {
 		var err error
 		entry,err = ParseGroupEntryNRT(tx.Bucket(tGroupNRT).Get(group))
-		if err!=nil { entry = nil }
+		if err!=nil || (entry!=nil && entry.IsTombstone()) { entry = nil }
 		return nil
 	})
 	return
@@ -66,52 +75,102 @@ func (g *GroupNRT) GetGroupBulkNRT(groups [][]byte) (entries []GroupPairNRT) {
 		bkt := tx.Bucket(tGroupNRT)
 		for _,group := range groups { 
 			entry,err := ParseGroupEntryNRT(bkt.Get(group))
-			if err!=nil || entry==nil { continue }
+			if err!=nil || entry==nil || entry.IsTombstone() { continue }
 			entries = append(entries,GroupPairNRT{group,*entry})
 		}
 		return nil
 	})
 	return
 }
+// Deprecated: The result is silently truncated, if g.Timeout expires. Use GetGroupsPageNRT.
 func (g *GroupNRT) GetGroupsNRT(after, prefix, suffix []byte) (entries []GroupPairNRT) {
-	tmo := time.After(g.Timeout)
-	g.DB.View(func(tx *bolt.Tx) error {
-		var k,v []byte
-		c := tx.Bucket(tGroupNRT).Cursor()
-		//var err error
-		na := after
-		if bytes.Compare(na,prefix)<0 { na = prefix }
-		if len(na)>0 {
-			k,v = c.Seek(na)
-			if len(k)!=0 && bytes.Compare(after,k) == 0 { k,v = c.Next() }
-		} else {
-			k,v = c.First()
-		}
-		for ; len(k)>0 ; k,v = c.Next() {
+	entries,_,_ = g.getGroups(after,prefix,0,func(k []byte) bool { return bytes.HasSuffix(k,suffix) })
+	return
+}
+// Returns up to limit groups (0 means no limit). If the listing is incomplete,
+// because of the limit or the timeout, resume is non-nil and must be passed as
+// after to get the next page.
+func (g *GroupNRT) GetGroupsPageNRT(after, prefix, suffix []byte, limit int) (entries []GroupPairNRT, resume []byte, err error) {
+	return g.getGroups(after,prefix,limit,func(k []byte) bool { return bytes.HasSuffix(k,suffix) })
+}
+// Returns the groups, that match the wildmat, such as "comp.*,!comp.os.*", in
+// pages like GetGroupsPageNRT.
+func (g *GroupNRT) GetGroupsWildmatNRT(after, wildmat []byte, limit int) (entries []GroupPairNRT, resume []byte, err error) {
+	w := ParseWildmat(wildmat)
+	return g.getGroups(after,w.Prefix(),limit,w.Match)
+}
+// Positions the cursor on the first key beyond after, that may start with prefix.
+func seekAfter(c *bolt.Cursor, after, prefix []byte) (k, v []byte) {
+	na := after
+	if bytes.Compare(na,prefix)<0 { na = prefix }
+	if len(na)>0 {
+		k,v = c.Seek(na)
+		if len(k)!=0 && bytes.Compare(after,k) == 0 { k,v = c.Next() }
+	} else {
+		k,v = c.First()
+	}
+	return
+}
+// Scans a page, starting at k,v, as long as inRange holds. Every key, for which
+// match holds, is passed to add, until limit keys (0 means no limit) have been
+// added. If there are more matching keys, or the timeout expired, it returns
+// the last examined key as resume marker. The timeout is only checked after
+// the first key, so that every page makes progress.
+func scanPage(c *bolt.Cursor, k, v []byte, limit int, tmo <-chan time.Time, inRange func(k []byte) bool, match func(k, v []byte) bool, add func(k, v []byte)) (resume []byte) {
+	var last []byte
+	n := 0
+	for ; len(k)>0 && inRange(k) ; k,v = c.Next() {
+		if last!=nil {
 			select {
 			case <-tmo:
-				return nil
+				return cloneb(last)
 			default:
 			}
-			// -------------------------------------------------
-			if !bytes.HasPrefix(k,prefix) { break }    // We are beyond our range.
-			if !bytes.HasSuffix(k,suffix) { continue } // Wrong suffix... Skip it.
-			je,err := ParseGroupEntryNRT(v)
-			if err!=nil { continue }
-			entries = append(entries,GroupPairNRT{cloneb(k),*je})
-			// -------------------------------------------------
 		}
+		if match(k,v) {
+			if limit>0 && n>=limit { return cloneb(last) } // There is more.
+			add(k,v)
+			n++
+		}
+		last = k
+	}
+	return nil
+}
+func (g *GroupNRT) getGroups(after, prefix []byte, limit int, match func(k []byte) bool) (entries []GroupPairNRT, resume []byte, err error) {
+	tmo := time.After(g.Timeout)
+	err = g.DB.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(tGroupNRT).Cursor()
+		k,v := seekAfter(c,after,prefix)
+		var je *GroupEntryNRT
+		resume = scanPage(c,k,v,limit,tmo,
+			func(k []byte) bool { return bytes.HasPrefix(k,prefix) },
+			func(k, v []byte) bool {
+				if !match(k) { return false } // Wrong suffix or pattern... Skip it.
+				var err error
+				je,err = ParseGroupEntryNRT(v)
+				return err==nil && !je.IsTombstone()
+			},
+			func(k, v []byte) { entries = append(entries,GroupPairNRT{cloneb(k),*je}) })
 		return nil
 	})
 	return
 }
+// Reports, whether e replaces old. The newer TimeStamp wins. Entries with
+// equal TimeStamps are ordered by their encoding, so that all nodes agree.
+func (e *GroupEntryNRT) supersedes(old *GroupEntryNRT) bool {
+	if old==nil { return true }
+	if e.TimeStamp!=old.TimeStamp { return e.TimeStamp>old.TimeStamp }
+	return bytes.Compare(e.Bytes(),old.Bytes())>0
+}
 func (g *GroupNRT) PutGroupNRT(group []byte, entry *GroupEntryNRT) (other *GroupEntryNRT,ok bool) {
 	err := g.DB.Batch(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket(tGroupNRT)
 		oldEntry,err := ParseGroupEntryNRT(bkt.Get(group))
-		if err!=nil || oldEntry==nil || oldEntry.TimeStamp < entry.TimeStamp {
+		if err!=nil { oldEntry = nil } // Missing or unreadable.
+		if entry.supersedes(oldEntry) {
 			err = bkt.Put(group,entry.Bytes()) // Create or Update.
 			if err!=nil { return nil }
+			if err := updateCreated(tx,group,oldEntry,entry); err!=nil { return err }
 		}
 		ok = true
 		other = oldEntry
@@ -120,6 +179,56 @@ func (g *GroupNRT) PutGroupNRT(group []byte, entry *GroupEntryNRT) (other *Group
 	if err!=nil { ok = false }
 	return
 }
+// Stores an entry, unless the existing one supersedes it.
+func putGroupNRT(tx *bolt.Tx, group []byte, entry *GroupEntryNRT) (written bool, err error) {
+	bkt := tx.Bucket(tGroupNRT)
+	oldEntry,err := ParseGroupEntryNRT(bkt.Get(group))
+	if err!=nil { oldEntry = nil } // Missing or unreadable.
+	if !entry.supersedes(oldEntry) { return false,nil }
+	if err = bkt.Put(group,entry.Bytes()); err!=nil { return }
+	if err = updateCreated(tx,group,oldEntry,entry); err!=nil { return }
+	return true,nil
+}
+// Stores many entries within one transaction, following the same rules as
+// PutGroupNRT. Returns the number of entries, that have been written.
+func (g *GroupNRT) PutGroupsBulkNRT(pairs []GroupPairNRT) (n int, err error) {
+	err = g.DB.Update(func(tx *bolt.Tx) error {
+		for i := range pairs {
+			written,err := putGroupNRT(tx,pairs[i].Key,&pairs[i].Value)
+			if err!=nil { return err }
+			if written { n++ }
+		}
+		return nil
+	})
+	if err!=nil { n = 0 }
+	return
+}
+// Removes a group by replacing it with a tombstone, timestamped ts.
+func (g *GroupNRT) RemoveGroupNRT(group []byte, ts int64) (ok bool) {
+	_,ok = g.PutGroupNRT(group,&GroupEntryNRT{Status:StatusTombstone,TimeStamp:ts})
+	return
+}
+// Deletes all tombstones, that are older than the grace period. The grace
+// period must exceed the time, an update takes to propagate to all nodes.
+func (g *GroupNRT) CollectTombstonesNRT(grace time.Duration) (n int, err error) {
+	limit := time.Now().Add(-grace).Unix()
+	err = g.DB.Update(func(tx *bolt.Tx) error {
+		var dead [][]byte
+		bkt := tx.Bucket(tGroupNRT)
+		c := bkt.Cursor()
+		for k,v := c.First(); len(k)>0; k,v = c.Next() {
+			je,err := ParseGroupEntryNRT(v)
+			if err!=nil || !je.IsTombstone() || je.TimeStamp>=limit { continue }
+			dead = append(dead,cloneb(k))
+		}
+		for _,k := range dead {
+			if err := bkt.Delete(k); err!=nil { return err }
+		}
+		n = len(dead)
+		return nil
+	})
+	return
+}
 
 // Deprecated!
 func (g *GroupNRT) updateGroupNRT(group []byte, entry *GroupEntryNRT) (other *GroupEntryNRT,ok bool) {
@@ -0,0 +1,148 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package groupsdb
+
+import "reflect"
+import "testing"
+import "time"
+
+func newTestGroups(t *testing.T, created map[string]int64, dead ...string) *GroupNRT {
+	g := newTestNRT(t)
+	for name,ts := range created {
+		if _,ok := g.PutGroupNRT([]byte(name),&GroupEntryNRT{Status:StatusPosting,TimeStamp:ts}); !ok { t.Fatal("PutGroupNRT failed") }
+	}
+	for _,name := range dead { g.RemoveGroupNRT([]byte(name),1000) }
+	return g
+}
+
+func pairKeys(entries []GroupPairNRT) (keys []string) {
+	for _,e := range entries { keys = append(keys,string(e.Key)) }
+	return
+}
+
+// Collects all pages. Every page must make progress.
+func allPages(t *testing.T, page func(after []byte) ([]GroupPairNRT,[]byte,error)) (pages [][]string) {
+	var after []byte
+	for i := 0; i<100; i++ {
+		entries,resume,err := page(after)
+		if err!=nil { t.Fatal(err) }
+		pages = append(pages,pairKeys(entries))
+		if resume==nil { return }
+		if len(resume)==0 { t.Fatal("empty resume marker") }
+		after = resume
+	}
+	t.Fatal("no progress")
+	return
+}
+
+var testGroups = map[string]int64{
+	"alt.a":10, "alt.b":20, "alt.c":30,
+	"comp.a":15, "comp.b":25,
+	"misc.a":5,
+}
+
+func TestGroupsPageResume(t *testing.T) {
+	g := newTestGroups(t,testGroups,"alt.c")
+	tests := []struct{
+		name   string
+		prefix string
+		limit  int
+		want   [][]string
+	}{
+		{"unlimited","",0,[][]string{{"alt.a","alt.b","comp.a","comp.b","misc.a"}}},
+		{"exact","",5,[][]string{{"alt.a","alt.b","comp.a","comp.b","misc.a"}}},
+		{"pages","",2,[][]string{{"alt.a","alt.b"},{"comp.a","comp.b"},{"misc.a"}}},
+		{"last page full","",1,[][]string{{"alt.a"},{"alt.b"},{"comp.a"},{"comp.b"},{"misc.a"}}},
+		{"prefix exact","alt.",2,[][]string{{"alt.a","alt.b"}}},
+		{"prefix tombstone at end","alt.",1,[][]string{{"alt.a"},{"alt.b"}}},
+		{"prefix pages","comp.",1,[][]string{{"comp.a"},{"comp.b"}}},
+		{"empty range","news.",1,[][]string{nil}},
+	}
+	for _,tt := range tests {
+		t.Run(tt.name,func(t *testing.T) {
+			got := allPages(t,func(after []byte) ([]GroupPairNRT,[]byte,error) {
+				return g.GetGroupsPageNRT(after,[]byte(tt.prefix),nil,tt.limit)
+			})
+			if !reflect.DeepEqual(got,tt.want) { t.Errorf("got %q, want %q",got,tt.want) }
+		})
+	}
+}
+
+func TestGroupsWildmatResume(t *testing.T) {
+	g := newTestGroups(t,testGroups)
+	tests := []struct{
+		wildmat string
+		limit   int
+		want    [][]string
+	}{
+		{"*.a",0,[][]string{{"alt.a","comp.a","misc.a"}}},
+		{"*.a",3,[][]string{{"alt.a","comp.a","misc.a"}}},
+		{"*.a",2,[][]string{{"alt.a","comp.a"},{"misc.a"}}},
+		{"alt.*,!alt.b",1,[][]string{{"alt.a"},{"alt.c"}}},
+		{"nothing.*",1,[][]string{nil}},
+	}
+	for _,tt := range tests {
+		got := allPages(t,func(after []byte) ([]GroupPairNRT,[]byte,error) {
+			return g.GetGroupsWildmatNRT(after,[]byte(tt.wildmat),tt.limit)
+		})
+		if !reflect.DeepEqual(got,tt.want) { t.Errorf("%s/%d: got %q, want %q",tt.wildmat,tt.limit,got,tt.want) }
+	}
+}
+
+func TestCreatedSinceResume(t *testing.T) {
+	g := newTestGroups(t,testGroups,"comp.a")
+	tests := []struct{
+		ts      int64
+		wildmat string
+		limit   int
+		want    [][]string
+	}{
+		{0,"",0,[][]string{{"misc.a","alt.a","alt.b","comp.b","alt.c"}}},
+		{20,"",0,[][]string{{"alt.b","comp.b","alt.c"}}},
+		{20,"",3,[][]string{{"alt.b","comp.b","alt.c"}}},
+		{0,"",2,[][]string{{"misc.a","alt.a"},{"alt.b","comp.b"},{"alt.c"}}},
+		{0,"alt.*",2,[][]string{{"alt.a","alt.b"},{"alt.c"}}},
+		{31,"",1,[][]string{nil}},
+	}
+	for _,tt := range tests {
+		got := allPages(t,func(after []byte) ([]GroupPairNRT,[]byte,error) {
+			return g.ListGroupsCreatedSince(tt.ts,[]byte(tt.wildmat),after,tt.limit)
+		})
+		if !reflect.DeepEqual(got,tt.want) { t.Errorf("%d/%s/%d: got %q, want %q",tt.ts,tt.wildmat,tt.limit,got,tt.want) }
+	}
+}
+
+// With an expired timeout, every page still returns at least one group.
+func TestGroupsPageTimeout(t *testing.T) {
+	g := newTestGroups(t,testGroups)
+	g.Timeout = time.Nanosecond
+	var all []string
+	for _,page := range allPages(t,func(after []byte) ([]GroupPairNRT,[]byte,error) {
+		time.Sleep(time.Millisecond)
+		return g.GetGroupsPageNRT(after,nil,nil,0)
+	}) { all = append(all,page...) }
+	if want := []string{"alt.a","alt.b","alt.c","comp.a","comp.b","misc.a"}; !reflect.DeepEqual(all,want) { t.Errorf("got %q, want %q",all,want) }
+}
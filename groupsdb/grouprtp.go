@@ -26,20 +26,36 @@ SOFTWARE.
 package groupsdb
 
 import "github.com/boltdb/bolt"
+import "errors"
+
+var EDifferentDB = errors.New("NRT and RTP parts are stored in different databases")
 
 type IGroupRTP interface{
 	GetGroupRTP(group []byte) (entry *GroupEntryRTP)
 	IncrementRTP(group []byte) (artnum int64,ok bool)
+	IncrementRTPBy(group []byte, n int64) (first, last int64,ok bool)
+	AllocateNumbers(counts map[string]int64) (first map[string]int64,ok bool)
 	RollbackArticleRTP(group []byte,artnum int64) (ok bool)
+	RecomputeRTP(group []byte) (entry *GroupEntryRTP)
+}
+
+// Enumerates the articles of a group (see RecomputeRTP). It is implemented by
+// messagedb.IGrpArtDB.
+type IArticleLister interface{
+	GetArticleNumbers(group []byte) (nums []int64)
 }
 
 var tGroupRTP = []byte("GRP.RTP")
 type GroupRTP struct{
 	DB *bolt.DB
+	
+	// Required by RecomputeRTP.
+	Articles IArticleLister
 }
 func (g *GroupRTP) Initialize() error {
 	return g.DB.Update(func(tx *bolt.Tx) error {
 		tx.CreateBucketIfNotExists(tGroupRTP)
+		tx.CreateBucketIfNotExists(tGroupRTPHoles)
 		return nil
 	})
 }
@@ -53,40 +69,183 @@ func (g *GroupRTP) GetGroupRTP(group []byte) (entry *GroupEntryRTP) {
 	return
 }
 func (g *GroupRTP) IncrementRTP(group []byte) (artnum int64,ok bool) {
+	ok = g.DB.Batch(func(tx *bolt.Tx) error {
+		artnum = increment(tx.Bucket(tGroupRTP),group,1)
+		return nil
+	})==nil
+	return
+}
+// Allocates n consecutive article numbers, first..last.
+func (g *GroupRTP) IncrementRTPBy(group []byte, n int64) (first, last int64,ok bool) {
+	if n<1 { return }
+	ok = g.DB.Batch(func(tx *bolt.Tx) error {
+		first = increment(tx.Bucket(tGroupRTP),group,n)
+		return nil
+	})==nil
+	last = first+n-1
+	return
+}
+// Allocates counts[group] consecutive article numbers in every group within
+// one transaction, as needed for crossposts. Returns the first number per group.
+func (g *GroupRTP) AllocateNumbers(counts map[string]int64) (first map[string]int64,ok bool) {
 	ok = g.DB.Batch(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket(tGroupRTP)
-		entry,err := ParseGroupEntryRTP(bkt.Get(group))
-		if err!=nil || entry==nil { entry = new(GroupEntryRTP) }
-		artnum = entry.High+1
-		entry.High=artnum
-		entry.Count++
-		if entry.Low == 0 { entry.Low = artnum }
-		bkt.Put(group,entry.Bytes())
+		first = make(map[string]int64,len(counts))
+		for group,n := range counts {
+			if n<1 { continue }
+			first[group] = increment(bkt,[]byte(group),n)
+		}
 		return nil
 	})==nil
+	if !ok { first = nil }
+	return
+}
+func increment(bkt *bolt.Bucket, group []byte, n int64) (first int64) {
+	entry,err := ParseGroupEntryRTP(bkt.Get(group))
+	if err!=nil || entry==nil { entry = new(GroupEntryRTP) }
+	first = entry.High+1
+	entry.High+=n
+	entry.Count+=n
+	if entry.Low == 0 { entry.Low = first }
+	bkt.Put(group,entry.Bytes())
 	return
 }
+// Removes an article number, that has been rolled back or expired. High is
+// kept, as numbers, that have been handed out, must never be reused; removed
+// numbers below High become holes, and an empty group gets Low = High+1.
 func (g *GroupRTP) RollbackArticleRTP(group []byte,artnum int64) (ok bool) {
 	ok = g.DB.Batch(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket(tGroupRTP)
+		holes := tx.Bucket(tGroupRTPHoles)
 		entry,err := ParseGroupEntryRTP(bkt.Get(group))
 		if err!=nil || entry==nil { entry = new(GroupEntryRTP) }
 		
+		if entry.Count<1 || artnum<entry.Low || artnum>entry.High { return nil } // Does not exist.
+		hb := holes.Bucket(group)
+		if _,_,in := findHole(hb,artnum); in { return nil } // Already rolled back.
+		
 		entry.Count--
-		isHigh := entry.High==artnum
-		isLow  := entry.Low==artnum
 		
-		if entry.Count<1 { // Reset count.
-			entry.High = 0
-			entry.Low  = 0
-		} else if isHigh {
-			entry.High--
-		} else if isLow {
+		if entry.Count<1 { // Empty.
+			entry.Low = entry.High+1
+			if hb!=nil {
+				if err := holes.DeleteBucket(group); err!=nil { return err }
+			}
+		} else if entry.Low==artnum {
 			entry.Low++
+			if f,l,in := findHole(hb,entry.Low); in { // Skip the hole above.
+				if err := hb.Delete(encodeNum(f)); err!=nil { return err }
+				entry.Low = l+1
+			}
+		} else {
+			hb,err = holes.CreateBucketIfNotExists(group)
+			if err!=nil { return err }
+			if err := addHole(hb,artnum); err!=nil { return err }
 		}
-		bkt.Put(group,entry.Bytes())
-		return nil
+		return bkt.Put(group,entry.Bytes())
 	})==nil
 	return
 }
+// A group with existing article numbers, see ImportGroups.
+type GroupImport struct{
+	Key []byte
+	NRT GroupEntryNRT
+	RTP GroupEntryRTP
+}
+
+// Merges an imported entry into the existing one. Numbers, that have been
+// handed out, must never be reused, so High only grows; the numbers above the
+// existing articles become a hole.
+func mergeRTP(bkt, holes *bolt.Bucket, group []byte, imp *GroupEntryRTP) error {
+	old,err := ParseGroupEntryRTP(bkt.Get(group))
+	if err!=nil || old==nil {
+		if holes.Bucket(group)!=nil {
+			if err := holes.DeleteBucket(group); err!=nil { return err }
+		}
+		return bkt.Put(group,imp.Bytes())
+	}
+	if imp.High<=old.High { return nil }
+	if old.Count==0 {
+		old.Low = imp.High+1
+	} else {
+		hb,err := holes.CreateBucketIfNotExists(group)
+		if err!=nil { return err }
+		first := old.High+1
+		if f,l,ok := findHole(hb,old.High); ok && l==old.High { first = f } // Extend the hole below.
+		if err := hb.Put(encodeNum(first),encodeNum(imp.High)); err!=nil { return err }
+	}
+	old.High = imp.High
+	return bkt.Put(group,old.Bytes())
+}
 
+// Imports groups with existing article numbers within one transaction. The
+// NRT entries follow the rules of PutGroupNRT; the RTP entries of the groups,
+// whose NRT entry has been rejected, are left alone. Otherwise, an existing
+// RTP entry only has its High mark raised. Both parts must be stored in the
+// same database. Returns the number of groups, that have been written.
+func ImportGroups(nrt *GroupNRT, rtp *GroupRTP, groups []GroupImport) (n int, err error) {
+	if nrt.DB!=rtp.DB { return 0,EDifferentDB }
+	err = nrt.DB.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(tGroupRTP)
+		holes := tx.Bucket(tGroupRTPHoles)
+		for i := range groups {
+			g := &groups[i]
+			written,err := putGroupNRT(tx,g.Key,&g.NRT)
+			if err!=nil { return err }
+			if !written { continue }
+			if err := mergeRTP(bkt,holes,g.Key,&g.RTP); err!=nil { return err }
+			n++
+		}
+		return nil
+	})
+	if err!=nil { n = 0 }
+	return
+}
+// Rebuilds Count, Low, High and the holes of a group from the article numbers
+// listed by g.Articles (it returns nil, if there is none). Articles, that are
+// stored while it runs, may end up as holes.
+//
+// High never decreases. Numbers above the last article become a hole. An empty
+// group gets Low = High+1.
+func (g *GroupRTP) RecomputeRTP(group []byte) (entry *GroupEntryRTP) {
+	if g.Articles==nil { return nil }
+	nums := g.Articles.GetArticleNumbers(group)
+	err := g.DB.Update(func(tx *bolt.Tx) error {
+		holes := tx.Bucket(tGroupRTPHoles)
+		if holes.Bucket(group)!=nil {
+			if err := holes.DeleteBucket(group); err!=nil { return err }
+		}
+		old,err := ParseGroupEntryRTP(tx.Bucket(tGroupRTP).Get(group))
+		if err!=nil || old==nil { old = new(GroupEntryRTP) }
+		var hb *bolt.Bucket
+		addHoles := func(first, last int64) (err error) {
+			if hb==nil {
+				hb,err = holes.CreateBucket(group)
+				if err!=nil { return }
+			}
+			return hb.Put(encodeNum(first),encodeNum(last))
+		}
+		ne := new(GroupEntryRTP)
+		for _,num := range nums {
+			if ne.Count>0 && num<=ne.High { continue } // Not ascending.
+			if ne.Count>0 && num>ne.High+1 { // Gap between two articles.
+				if err := addHoles(ne.High+1,num-1); err!=nil { return err }
+			}
+			if ne.Count==0 { ne.Low = num }
+			ne.High = num
+			ne.Count++
+		}
+		// Numbers, that have been handed out, must never be reused.
+		if ne.Count==0 {
+			if old.High>ne.High { ne.High = old.High }
+			ne.Low = ne.High+1
+		} else if old.High>ne.High {
+			if err := addHoles(ne.High+1,old.High); err!=nil { return err }
+			ne.High = old.High
+		}
+		entry = ne
+		return tx.Bucket(tGroupRTP).Put(group,ne.Bytes())
+	})
+	if err!=nil { entry = nil }
+	return
+}
@@ -38,11 +38,14 @@ func cloneb(i []byte) (j []byte) {
 type GroupEntryNRT struct{
 	Description []byte
 	Status byte
+	Alias  []byte // Target group of StatusAlias.
 	
 	// The timestamp is mandatory to propagate updates.
 	TimeStamp int64 // Timestamp (UNIX-format)
 }
+
 func (g GroupEntryNRT) String() string {
+	if g.Status==StatusAlias { return fmt.Sprintf("{%q %q->%q %d}",g.Description,g.Status,g.Alias,g.TimeStamp) }
 	return fmt.Sprintf("{%q %q %d}",g.Description,g.Status,g.TimeStamp)
 }
 
@@ -54,7 +57,17 @@ func (g GroupPairNRT) String() string {
 	return fmt.Sprintf("{%q %v}",g.Key,g.Value)
 }
 
+// Stored layout.
 var ce_GroupEntryNRT = serializer.With(&GroupEntryNRT{}).
+	Field("Description").
+	Field("Status").
+	Field("TimeStamp").
+	Field("Alias")
+//-----------------------------------------------
+
+// Layout of entries, stored before the Alias field was added. It is also the
+// original wire format, see CeGroupEntryNRT.
+var ce_GroupEntryNRTv0 = serializer.With(&GroupEntryNRT{}).
 	Field("Description").
 	Field("Status").
 	Field("TimeStamp")
@@ -68,8 +81,22 @@ var ce_GroupPairNRT = serializer.WithInline(&GroupPairNRT{}).
 		Field("TimeStamp")  )
 //-----------------------------------------------
 
+var ce_GroupPairNRTv1 = serializer.WithInline(&GroupPairNRT{}).
+	Field("Key").
+	FieldWith("Value",serializer.WithInline(&GroupEntryNRT{}).
+		Field("Description").
+		Field("Status").
+		Field("TimeStamp").
+		Field("Alias")  )
+//-----------------------------------------------
+
+// The original wire format, without Alias. Peers, that predate the Alias
+// field, only understand this one, so it must not change.
 func CeGroupPairNRT() serializer.CodecElement { return ce_GroupPairNRT }
 
+// The wire format including Alias.
+func CeGroupPairNRTv1() serializer.CodecElement { return ce_GroupPairNRTv1 }
+
 
 // Group Entry, Realtime-Part
 type GroupEntryRTP struct{
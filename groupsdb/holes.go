@@ -0,0 +1,74 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package groupsdb
+
+import "github.com/boltdb/bolt"
+import "encoding/binary"
+
+// Holes are the rolled back or expired article numbers between Low and High.
+// Every group has a sub-bucket of non-overlapping, non-adjacent intervals,
+// mapping the first number to the last number of the hole.
+var tGroupRTPHoles = []byte("GRP.RTP.HOLES")
+
+func encodeNum(n int64) []byte {
+	b := make([]byte,8)
+	binary.BigEndian.PutUint64(b,uint64(n))
+	return b
+}
+func decodeNum(b []byte) int64 {
+	if len(b)!=8 { return 0 }
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+// Returns the hole, that contains num.
+func findHole(bkt *bolt.Bucket, num int64) (first, last int64, ok bool) {
+	if bkt==nil { return }
+	c := bkt.Cursor()
+	k,v := c.Seek(encodeNum(num))
+	if len(k)==0 {
+		k,v = c.Last()
+	} else if decodeNum(k)>num {
+		k,v = c.Prev()
+	}
+	if len(k)==0 { return }
+	first,last = decodeNum(k),decodeNum(v)
+	ok = first<=num && num<=last
+	return
+}
+
+// Adds num as a hole, merging it with adjacent holes.
+func addHole(bkt *bolt.Bucket, num int64) error {
+	first,last := num,num
+	if f,l,ok := findHole(bkt,num-1); ok && l==num-1 {
+		first = f
+	}
+	if f,l,ok := findHole(bkt,num+1); ok && f==num+1 {
+		last = l
+		if err := bkt.Delete(encodeNum(f)); err!=nil { return err }
+	}
+	return bkt.Put(encodeNum(first),encodeNum(last))
+}
+
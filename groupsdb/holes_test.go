@@ -0,0 +1,129 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package groupsdb
+
+import "github.com/boltdb/bolt"
+import "path/filepath"
+import "reflect"
+import "testing"
+
+func openTestDB(t *testing.T) *bolt.DB {
+	db,err := bolt.Open(filepath.Join(t.TempDir(),"test.db"),0600,nil)
+	if err!=nil { t.Fatal(err) }
+	t.Cleanup(func(){ db.Close() })
+	return db
+}
+
+func newTestRTP(t *testing.T) *GroupRTP {
+	g := &GroupRTP{DB:openTestDB(t)}
+	if err := g.Initialize(); err!=nil { t.Fatal(err) }
+	return g
+}
+
+// Returns the holes of a group as [first,last] pairs.
+func listHoles(t *testing.T, g *GroupRTP, group []byte) (h [][2]int64) {
+	g.DB.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(tGroupRTPHoles).Bucket(group)
+		if bkt==nil { return nil }
+		return bkt.ForEach(func(k, v []byte) error {
+			h = append(h,[2]int64{decodeNum(k),decodeNum(v)})
+			return nil
+		})
+	})
+	return
+}
+
+func TestRollbackHoles(t *testing.T) {
+	group := []byte("alt.test")
+	tests := []struct{
+		name     string
+		alloc    int64
+		rollback []int64
+		entry    GroupEntryRTP
+		holes    [][2]int64
+	}{
+		{"none",5,nil,GroupEntryRTP{5,1,5},nil},
+		{"middle",5,[]int64{3},GroupEntryRTP{4,1,5},[][2]int64{{3,3}}},
+		{"merge",6,[]int64{2,4,3},GroupEntryRTP{3,1,6},[][2]int64{{2,4}}},
+		{"twice",5,[]int64{3,3},GroupEntryRTP{4,1,5},[][2]int64{{3,3}}},
+		{"outside",5,[]int64{0,6},GroupEntryRTP{5,1,5},nil},
+		{"high",5,[]int64{5},GroupEntryRTP{4,1,5},[][2]int64{{5,5}}},
+		{"high merges hole",5,[]int64{4,3,5},GroupEntryRTP{2,1,5},[][2]int64{{3,5}}},
+		{"low skips hole",5,[]int64{2,3,1},GroupEntryRTP{2,4,5},nil},
+		{"all",3,[]int64{2,1,3},GroupEntryRTP{0,4,3},nil},
+		{"all from top",3,[]int64{3,2,1},GroupEntryRTP{0,4,3},nil},
+	}
+	for _,tt := range tests {
+		t.Run(tt.name,func(t *testing.T) {
+			g := newTestRTP(t)
+			if _,_,ok := g.IncrementRTPBy(group,tt.alloc); !ok { t.Fatal("IncrementRTPBy failed") }
+			for _,num := range tt.rollback {
+				if !g.RollbackArticleRTP(group,num) { t.Fatalf("RollbackArticleRTP(%d) failed",num) }
+			}
+			if e := g.GetGroupRTP(group); e==nil || *e!=tt.entry { t.Errorf("entry = %v, want %v",e,tt.entry) }
+			if h := listHoles(t,g,group); !reflect.DeepEqual(h,tt.holes) { t.Errorf("holes = %v, want %v",h,tt.holes) }
+			
+			// Rolled back numbers are never handed out again.
+			if n,ok := g.IncrementRTP(group); !ok || n!=tt.alloc+1 { t.Errorf("next number = %d, want %d",n,tt.alloc+1) }
+		})
+	}
+}
+
+// Article numbers per group.
+type testArticles map[string][]int64
+
+func (a testArticles) GetArticleNumbers(group []byte) []int64 { return a[string(group)] }
+
+func TestRecomputeRTP(t *testing.T) {
+	group := []byte("alt.test")
+	tests := []struct{
+		name     string
+		alloc    int64
+		articles []int64
+		entry    GroupEntryRTP
+		holes    [][2]int64
+	}{
+		{"empty",0,nil,GroupEntryRTP{0,1,0},nil},
+		{"expired",5,nil,GroupEntryRTP{0,6,5},nil},
+		{"dense",3,[]int64{1,2,3},GroupEntryRTP{3,1,3},nil},
+		{"gaps",7,[]int64{2,3,6,7},GroupEntryRTP{4,2,7},[][2]int64{{4,5}}},
+		{"tail expired",9,[]int64{2,3,6},GroupEntryRTP{3,2,9},[][2]int64{{4,5},{7,9}}},
+		{"beyond high",2,[]int64{1,4},GroupEntryRTP{2,1,4},[][2]int64{{2,3}}},
+	}
+	for _,tt := range tests {
+		t.Run(tt.name,func(t *testing.T) {
+			g := newTestRTP(t)
+			g.Articles = testArticles{string(group):tt.articles}
+			if tt.alloc>0 { g.IncrementRTPBy(group,tt.alloc) }
+			e := g.RecomputeRTP(group)
+			if e==nil || *e!=tt.entry { t.Errorf("entry = %v, want %v",e,tt.entry) }
+			if h := listHoles(t,g,group); !reflect.DeepEqual(h,tt.holes) { t.Errorf("holes = %v, want %v",h,tt.holes) }
+			
+			// New numbers continue above High.
+			if n,ok := g.IncrementRTP(group); !ok || n!=tt.entry.High+1 { t.Errorf("next number = %d, want %d",n,tt.entry.High+1) }
+		})
+	}
+}
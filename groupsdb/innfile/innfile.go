@@ -0,0 +1,150 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+/*
+Reading and writing of the INN active and newsgroups files.
+
+The active file has one line per group:
+
+	<name> <high> <low> <status>
+
+where status is one of y, n, m, x, j or =<alias>. The newsgroups file has one
+line per group:
+
+	<name><tabs><description>
+*/
+package innfile
+
+import "github.com/byte-mug/articledb/groupsdb"
+import "bufio"
+import "bytes"
+import "fmt"
+import "io"
+import "strconv"
+
+type ActiveLine struct{
+	Group  []byte
+	High   int64
+	Low    int64
+	Status byte
+	Alias  []byte
+}
+
+// The INN active file does not record the number of articles, so it is
+// estimated from the marks. Use GroupRTP.RecomputeRTP, once the articles are
+// imported, to get the exact count.
+func (a *ActiveLine) RTP() groupsdb.GroupEntryRTP {
+	if a.High<a.Low { return groupsdb.GroupEntryRTP{Count:0,Low:a.Low,High:a.High} }
+	return groupsdb.GroupEntryRTP{Count:a.High-a.Low+1,Low:a.Low,High:a.High}
+}
+
+func ReadActive(r io.Reader) (lines []ActiveLine, err error) {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		f := bytes.Fields(s.Bytes())
+		if len(f)==0 { continue }
+		if len(f)!=4 || len(f[3])==0 { return lines,fmt.Errorf("active:%d: malformed line",n) }
+		var a ActiveLine
+		a.Group = append([]byte(nil),f[0]...)
+		a.High,err = strconv.ParseInt(string(f[1]),10,64)
+		if err!=nil { return lines,fmt.Errorf("active:%d: %v",n,err) }
+		a.Low,err = strconv.ParseInt(string(f[2]),10,64)
+		if err!=nil { return lines,fmt.Errorf("active:%d: %v",n,err) }
+		a.Status = f[3][0]
+		if a.Status==groupsdb.StatusAlias { a.Alias = append([]byte(nil),f[3][1:]...) }
+		lines = append(lines,a)
+	}
+	err = s.Err()
+	return
+}
+
+func WriteActive(w io.Writer, lines []ActiveLine) error {
+	bw := bufio.NewWriter(w)
+	for _,a := range lines {
+		_,err := fmt.Fprintf(bw,"%s %010d %010d %c%s\n",a.Group,a.High,a.Low,a.Status,a.Alias)
+		if err!=nil { return err }
+	}
+	return bw.Flush()
+}
+
+// Reads the newsgroups file into a map from group to description.
+func ReadNewsgroups(r io.Reader) (descs map[string][]byte, err error) {
+	descs = make(map[string][]byte)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Bytes()
+		i := bytes.IndexAny(line," \t")
+		if i<0 {
+			if len(line)>0 { descs[string(line)] = nil }
+			continue
+		}
+		descs[string(line[:i])] = append([]byte(nil),bytes.TrimSpace(line[i:])...)
+	}
+	err = s.Err()
+	return
+}
+
+func WriteNewsgroups(w io.Writer, groups []groupsdb.GroupPairNRT) error {
+	bw := bufio.NewWriter(w)
+	for _,g := range groups {
+		// Pad the name to a multiple of 8 columns, as INN does.
+		tabs := 3-len(g.Key)/8
+		if tabs<1 { tabs = 1 }
+		_,err := fmt.Fprintf(bw,"%s%s%s\n",g.Key,bytes.Repeat([]byte("\t"),tabs),g.Value.Description)
+		if err!=nil { return err }
+	}
+	return bw.Flush()
+}
+
+// Imports the groups of an active file, and their descriptions (descs may be
+// nil), timestamped ts, within one transaction (see groupsdb.ImportGroups).
+func Import(nrt *groupsdb.GroupNRT, rtp *groupsdb.GroupRTP, active []ActiveLine, descs map[string][]byte, ts int64) (n int, err error) {
+	groups := make([]groupsdb.GroupImport,len(active))
+	for i := range active {
+		a := &active[i]
+		groups[i].Key = a.Group
+		groups[i].NRT = groupsdb.GroupEntryNRT{Description:descs[string(a.Group)],Status:a.Status,Alias:a.Alias,TimeStamp:ts}
+		groups[i].RTP = a.RTP()
+	}
+	return groupsdb.ImportGroups(nrt,rtp,groups)
+}
+
+// Exports all groups (except tombstones) as active lines and newsgroups entries.
+func Export(nrt *groupsdb.GroupNRT, rtp groupsdb.IGroupRTP) (active []ActiveLine, groups []groupsdb.GroupPairNRT, err error) {
+	all,err := nrt.ExportRangeNRT(nil,nil)
+	if err!=nil { return }
+	for _,p := range all {
+		if p.Value.IsTombstone() { continue }
+		a := ActiveLine{Group:p.Key,Status:p.Value.Status,Alias:p.Value.Alias}
+		if a.Status==0 { a.Status = groupsdb.StatusPosting }
+		if a.Status!=groupsdb.StatusAlias { a.Alias = nil }
+		if e := rtp.GetGroupRTP(p.Key); e!=nil { a.High,a.Low = e.High,e.Low }
+		if a.Low==0 { a.Low = a.High+1 } // Empty group, as INN writes it.
+		active = append(active,a)
+		groups = append(groups,p)
+	}
+	return
+}
+
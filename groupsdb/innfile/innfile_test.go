@@ -0,0 +1,159 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package innfile
+
+import "github.com/byte-mug/articledb/groupsdb"
+import "github.com/boltdb/bolt"
+import "bytes"
+import "path/filepath"
+import "reflect"
+import "strings"
+import "testing"
+
+func TestReadActive(t *testing.T) {
+	tests := []struct{
+		name  string
+		in    string
+		want  []ActiveLine
+		fails bool
+	}{
+		{"empty","",nil,false},
+		{"posting","comp.lang.go 0000000012 0000000003 y\n",
+			[]ActiveLine{{Group:[]byte("comp.lang.go"),High:12,Low:3,Status:'y'}},false},
+		{"statuses","a 1 1 n\nb 1 1 m\nc 1 1 x\nd 1 1 j\n",
+			[]ActiveLine{
+				{Group:[]byte("a"),High:1,Low:1,Status:'n'},
+				{Group:[]byte("b"),High:1,Low:1,Status:'m'},
+				{Group:[]byte("c"),High:1,Low:1,Status:'x'},
+				{Group:[]byte("d"),High:1,Low:1,Status:'j'}},false},
+		{"alias","old.name 0000000000 0000000001 =new.name\n",
+			[]ActiveLine{{Group:[]byte("old.name"),High:0,Low:1,Status:'=',Alias:[]byte("new.name")}},false},
+		{"blank lines and tabs","\n  a\t5\t2\ty  \n\n",
+			[]ActiveLine{{Group:[]byte("a"),High:5,Low:2,Status:'y'}},false},
+		{"too few fields","a 1 y\n",nil,true},
+		{"too many fields","a 1 1 y z\n",nil,true},
+		{"bad high","a x 1 y\n",nil,true},
+		{"bad low","a 1 -x y\n",nil,true},
+	}
+	for _,tt := range tests {
+		t.Run(tt.name,func(t *testing.T) {
+			got,err := ReadActive(strings.NewReader(tt.in))
+			if (err!=nil)!=tt.fails { t.Fatalf("err = %v, fails = %v",err,tt.fails) }
+			if tt.fails { return }
+			if !reflect.DeepEqual(got,tt.want) { t.Errorf("got %v, want %v",got,tt.want) }
+		})
+	}
+}
+
+func TestActiveRoundTrip(t *testing.T) {
+	in := "a.b 0000000012 0000000003 y\nalias.old 0000000000 0000000001 =a.b\n"
+	lines,err := ReadActive(strings.NewReader(in))
+	if err!=nil { t.Fatal(err) }
+	buf := new(bytes.Buffer)
+	if err := WriteActive(buf,lines); err!=nil { t.Fatal(err) }
+	if buf.String()!=in { t.Errorf("got %q, want %q",buf.String(),in) }
+}
+
+func TestReadNewsgroups(t *testing.T) {
+	tests := []struct{
+		name string
+		in   string
+		want map[string][]byte
+	}{
+		{"empty","",map[string][]byte{}},
+		{"tabs","comp.lang.go\t\tThe Go language.\n",map[string][]byte{"comp.lang.go":[]byte("The Go language.")}},
+		{"spaces","a.b   Some group  \n",map[string][]byte{"a.b":[]byte("Some group")}},
+		{"no description","a.b\n",map[string][]byte{"a.b":nil}},
+		{"blank line","\na.b\tx\n",map[string][]byte{"a.b":[]byte("x")}},
+	}
+	for _,tt := range tests {
+		t.Run(tt.name,func(t *testing.T) {
+			got,err := ReadNewsgroups(strings.NewReader(tt.in))
+			if err!=nil { t.Fatal(err) }
+			if !reflect.DeepEqual(got,tt.want) { t.Errorf("got %q, want %q",got,tt.want) }
+		})
+	}
+}
+
+func TestActiveRTP(t *testing.T) {
+	tests := []struct{
+		line ActiveLine
+		want groupsdb.GroupEntryRTP
+	}{
+		{ActiveLine{High:12,Low:3},groupsdb.GroupEntryRTP{Count:10,Low:3,High:12}},
+		{ActiveLine{High:5,Low:5},groupsdb.GroupEntryRTP{Count:1,Low:5,High:5}},
+		{ActiveLine{High:0,Low:1},groupsdb.GroupEntryRTP{Count:0,Low:1,High:0}},
+		{ActiveLine{High:7,Low:8},groupsdb.GroupEntryRTP{Count:0,Low:8,High:7}},
+	}
+	for _,tt := range tests {
+		if got := tt.line.RTP(); got!=tt.want { t.Errorf("%d-%d: got %v, want %v",tt.line.Low,tt.line.High,got,tt.want) }
+	}
+}
+
+func TestImportMerge(t *testing.T) {
+	db,err := bolt.Open(filepath.Join(t.TempDir(),"test.db"),0600,nil)
+	if err!=nil { t.Fatal(err) }
+	defer db.Close()
+	nrt,rtp := &groupsdb.GroupNRT{DB:db},&groupsdb.GroupRTP{DB:db}
+	if err := nrt.Initialize(); err!=nil { t.Fatal(err) }
+	if err := rtp.Initialize(); err!=nil { t.Fatal(err) }
+	
+	// Existing groups: "newer" has a newer NRT entry than the import.
+	nrt.PutGroupNRT([]byte("newer"),&groupsdb.GroupEntryNRT{Status:'y',TimeStamp:200})
+	rtp.IncrementRTPBy([]byte("newer"),5)
+	nrt.PutGroupNRT([]byte("older"),&groupsdb.GroupEntryNRT{Status:'y',TimeStamp:50})
+	rtp.IncrementRTPBy([]byte("older"),20)
+	nrt.PutGroupNRT([]byte("behind"),&groupsdb.GroupEntryNRT{Status:'y',TimeStamp:50})
+	rtp.IncrementRTPBy([]byte("behind"),5)
+	
+	active := []ActiveLine{
+		{Group:[]byte("fresh"),High:12,Low:3,Status:'y'},
+		{Group:[]byte("newer"),High:99,Low:90,Status:'n'},
+		{Group:[]byte("older"),High:10,Low:1,Status:'m'},
+		{Group:[]byte("behind"),High:9,Low:1,Status:'y'},
+	}
+	n,err := Import(nrt,rtp,active,nil,100)
+	if err!=nil { t.Fatal(err) }
+	if n!=3 { t.Errorf("imported %d groups, want 3",n) }
+	
+	tests := []struct{
+		group  string
+		status byte
+		rtp    groupsdb.GroupEntryRTP
+	}{
+		{"fresh",'y',groupsdb.GroupEntryRTP{Count:10,Low:3,High:12}},
+		{"newer",'y',groupsdb.GroupEntryRTP{Count:5,Low:1,High:5}},   // Rejected, untouched.
+		{"older",'m',groupsdb.GroupEntryRTP{Count:20,Low:1,High:20}}, // High is never lowered.
+		{"behind",'y',groupsdb.GroupEntryRTP{Count:5,Low:1,High:9}},  // High is raised.
+	}
+	for _,tt := range tests {
+		if e := nrt.GetGroupNRT([]byte(tt.group)); e==nil || e.Status!=tt.status { t.Errorf("%s: NRT = %v, want status %c",tt.group,e,tt.status) }
+		if e := rtp.GetGroupRTP([]byte(tt.group)); e==nil || *e!=tt.rtp { t.Errorf("%s: RTP = %v, want %v",tt.group,e,tt.rtp) }
+	}
+	// The raised numbers are a hole, so rolling them back changes nothing.
+	rtp.RollbackArticleRTP([]byte("behind"),7)
+	if e := rtp.GetGroupRTP([]byte("behind")); e==nil || e.Count!=5 { t.Errorf("behind: RTP after rollback = %v",e) }
+}
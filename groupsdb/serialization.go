@@ -51,6 +51,9 @@ func (e *GroupEntryRTP) Bytes() []byte {
 
 func ParseGroupEntryNRT(b []byte) (*GroupEntryNRT,error){
 	i,e := serializer.Deserialize(ce_GroupEntryNRT,preciseio.PreciseReader{bytes.NewReader(b)})
+	if e!=nil { // Fall back to the legacy layout.
+		i,e = serializer.Deserialize(ce_GroupEntryNRTv0,preciseio.PreciseReader{bytes.NewReader(b)})
+	}
 	g,_ := i.(*GroupEntryNRT)
 	return g,e
 }
@@ -60,7 +63,11 @@ func ParseGroupEntryRTP(b []byte) (*GroupEntryRTP,error){
 	g,_ := i.(*GroupEntryRTP)
 	return g,e
 }
-func CeGroupEntryNRT() serializer.CodecElement { return ce_GroupEntryNRT }
+// The original wire format, without Alias (see CeGroupPairNRT).
+func CeGroupEntryNRT() serializer.CodecElement { return ce_GroupEntryNRTv0 }
+
+// The wire format including Alias.
+func CeGroupEntryNRTv1() serializer.CodecElement { return ce_GroupEntryNRT }
 func CeGroupEntryRTP() serializer.CodecElement { return ce_GroupEntryRTP }
 
 
@@ -0,0 +1,107 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package groupsdb
+
+import "errors"
+
+// Group statuses, as in the INN active file.
+const (
+	StatusPosting   byte = 'y' // Local posting allowed.
+	StatusNoPosting byte = 'n' // No local posting; articles from peers are accepted.
+	StatusModerated byte = 'm' // Postings are sent to the moderator, unless approved.
+	StatusNoLocal   byte = 'x' // Neither local posting nor articles from peers.
+	StatusJunk      byte = 'j' // Articles are accepted, but filed into JunkGroup.
+	StatusAlias     byte = '=' // Articles are filed into the group named by Alias.
+	
+	// Status of a removed group (rmgroup). The tombstone is kept, so that an older
+	// copy of the group from another node can not resurrect it.
+	StatusTombstone byte = '-'
+)
+
+// The group, that articles for StatusJunk groups are filed into.
+var JunkGroup = []byte("junk")
+
+var (
+	ENoSuchGroup = errors.New("no such newsgroup")
+	ENoPosting   = errors.New("posting not allowed")
+	EModerated   = errors.New("moderated newsgroup, article not approved")
+	EAliasLoop   = errors.New("alias loop")
+)
+
+// Entries, stored before the statuses were defined, have a zero Status. They
+// are treated as StatusPosting.
+func (g *GroupEntryNRT) status() byte {
+	if g.Status==0 { return StatusPosting }
+	return g.Status
+}
+
+func (g *GroupEntryNRT) IsTombstone() bool { return g.Status==StatusTombstone }
+func (g *GroupEntryNRT) IsModerated() bool { return g.Status==StatusModerated }
+func (g *GroupEntryNRT) IsAlias() bool { return g.Status==StatusAlias }
+
+// Reports, whether local users may post to the group.
+func (g *GroupEntryNRT) PostingAllowed() bool {
+	switch g.status() {
+	case StatusPosting,StatusModerated,StatusJunk,StatusAlias: return true
+	}
+	return false
+}
+// Reports, whether articles from peers are accepted.
+func (g *GroupEntryNRT) AcceptsFeed() bool {
+	switch g.status() {
+	case StatusNoLocal,StatusTombstone: return false
+	}
+	return true
+}
+
+// Maximum length of an alias chain.
+const maxAliasDepth = 8
+
+// Checks, whether an article may be filed into group, and returns the group,
+// it must actually be filed into (following aliases and junk). local is true
+// for local postings, approved is true, if the article carries an Approved
+// header.
+func CheckPosting(nrt IGroupNRT, group []byte, local, approved bool) (target []byte, err error) {
+	target = group
+	for i := 0; i<maxAliasDepth; i++ {
+		entry := nrt.GetGroupNRT(target)
+		if entry==nil { return nil,ENoSuchGroup }
+		if local && !entry.PostingAllowed() { return nil,ENoPosting }
+		if !local && !entry.AcceptsFeed() { return nil,ENoPosting }
+		switch entry.status() {
+		case StatusModerated:
+			if local && !approved { return nil,EModerated }
+		case StatusJunk:
+			return JunkGroup,nil
+		case StatusAlias:
+			target = entry.Alias
+			continue
+		}
+		return target,nil
+	}
+	return nil,EAliasLoop
+}
+
@@ -0,0 +1,132 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package groupsdb
+
+import "bytes"
+import "time"
+
+// Reconciles the group list of two nodes. Starting with the empty prefix, the
+// digests of both nodes are compared, and every differing range is either
+// descended into or, if it is small enough, exchanged entirely. Entries are
+// written with PutGroupNRT, so the newer TimeStamp (including tombstones) wins
+// on both sides. Entries with equal TimeStamps are ordered by their encoding.
+//
+// If a digest or a range can't be fetched from either side, the round is
+// aborted with an error, rather than mistaking the missing data for an empty range.
+type Syncer struct{
+	Local  IGroupSyncNRT
+	Remote IGroupSyncNRT
+	
+	// Ranges with no more than Threshold entries are exchanged without further descending. Defaults to 64.
+	Threshold int64
+	
+	// Interval between two Sync runs in Run. Defaults to one minute.
+	Interval time.Duration
+}
+
+// Reconciles both nodes once.
+func (s *Syncer) Sync() (pulled, pushed int, err error) {
+	err = s.sync(nil,&pulled,&pushed)
+	return
+}
+
+func (s *Syncer) sync(prefix []byte, pulled, pushed *int) error {
+	threshold := s.Threshold
+	if threshold<=0 { threshold = 64 }
+	rdigests,err := s.Remote.DigestNRT(prefix)
+	if err!=nil { return err }
+	ldigests,err := s.Local.DigestNRT(prefix)
+	if err!=nil { return err }
+	remote := make(map[string]GroupDigest)
+	for _,d := range rdigests { remote[string(d.Key)] = d }
+	
+	var differ []GroupDigest
+	for _,d := range ldigests {
+		r,ok := remote[string(d.Key)]
+		delete(remote,string(d.Key))
+		if ok && r.Count==d.Count && bytes.Equal(r.Hash,d.Hash) { continue }
+		if r.Count>d.Count { d.Count = r.Count }
+		differ = append(differ,d)
+	}
+	for _,r := range remote { differ = append(differ,r) } // Only on the remote side.
+	
+	for _,d := range differ {
+		switch {
+		case len(d.Key)==len(prefix):
+			// The group, that is equal to the prefix.
+			err = s.exchange(d.Key,append(cloneb(d.Key),0),pulled,pushed)
+		case d.Count<=threshold:
+			err = s.exchange(d.Key,prefixEnd(d.Key),pulled,pushed)
+		default:
+			err = s.sync(d.Key,pulled,pushed)
+		}
+		if err!=nil { return err }
+	}
+	return nil
+}
+
+func (s *Syncer) exchange(from, to []byte, pulled, pushed *int) error {
+	rentries,err := s.Remote.ExportRangeNRT(from,to)
+	if err!=nil { return err }
+	lentries,err := s.Local.ExportRangeNRT(from,to)
+	if err!=nil { return err }
+	local := make(map[string]*GroupEntryNRT)
+	for _,p := range lentries {
+		e := p.Value
+		local[string(p.Key)] = &e
+	}
+	for _,p := range rentries {
+		e := p.Value
+		l,ok := local[string(p.Key)]
+		delete(local,string(p.Key))
+		switch {
+		case !ok || e.supersedes(l):
+			if _,ok := s.Local.PutGroupNRT(p.Key,&e); ok { *pulled++ }
+		case l.supersedes(&e):
+			if _,ok := s.Remote.PutGroupNRT(p.Key,l); ok { *pushed++ }
+		}
+	}
+	for k,l := range local { // Only on the local side.
+		if _,ok := s.Remote.PutGroupNRT([]byte(k),l); ok { *pushed++ }
+	}
+	return nil
+}
+
+// Calls Sync periodically, until stop is closed. Failed rounds are retried in the next interval.
+func (s *Syncer) Run(stop <-chan struct{}) {
+	interval := s.Interval
+	if interval<=0 { interval = time.Minute }
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		s.Sync()
+		select {
+		case <-stop: return
+		case <-tick.C:
+		}
+	}
+}
+
@@ -0,0 +1,113 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package groupsdb
+
+import "errors"
+import "fmt"
+import "reflect"
+import "testing"
+
+func newTestNRT(t *testing.T) *GroupNRT {
+	g := &GroupNRT{DB:openTestDB(t)}
+	if err := g.Initialize(); err!=nil { t.Fatal(err) }
+	return g
+}
+
+// Returns the encoded entries, as nil and empty slices decode differently.
+func dumpNRT(t *testing.T, g *GroupNRT) map[string]string {
+	all,err := g.ExportRangeNRT(nil,nil)
+	if err!=nil { t.Fatal(err) }
+	m := make(map[string]string)
+	for _,p := range all { m[string(p.Key)] = string(p.Value.Bytes()) }
+	return m
+}
+
+type failingSync struct{ IGroupSyncNRT }
+func (failingSync) DigestNRT(prefix []byte) ([]GroupDigest,error) { return nil,errors.New("unreachable") }
+
+func TestSyncMerge(t *testing.T) {
+	type groups map[string]GroupEntryNRT
+	tests := []struct{
+		name          string
+		local,remote  groups
+		want          groups
+	}{
+		{"empty",groups{},groups{},groups{}},
+		{"local only",
+			groups{"a.b":{Description:[]byte("ab"),TimeStamp:1}},groups{},
+			groups{"a.b":{Description:[]byte("ab"),TimeStamp:1}}},
+		{"remote only",
+			groups{},groups{"a.b":{Description:[]byte("ab"),TimeStamp:1}},
+			groups{"a.b":{Description:[]byte("ab"),TimeStamp:1}}},
+		{"newer wins",
+			groups{"a":{Description:[]byte("old"),TimeStamp:1},"b":{Description:[]byte("new"),TimeStamp:5}},
+			groups{"a":{Description:[]byte("new"),TimeStamp:2},"b":{Description:[]byte("old"),TimeStamp:4}},
+			groups{"a":{Description:[]byte("new"),TimeStamp:2},"b":{Description:[]byte("new"),TimeStamp:5}}},
+		{"tombstone wins",
+			groups{"a":{Status:StatusTombstone,TimeStamp:3}},
+			groups{"a":{Description:[]byte("a"),TimeStamp:2}},
+			groups{"a":{Status:StatusTombstone,TimeStamp:3}}},
+		{"equal timestamps",
+			groups{"a":{Description:[]byte("x"),TimeStamp:7}},
+			groups{"a":{Description:[]byte("y"),TimeStamp:7}},
+			groups{"a":{Description:[]byte("y"),TimeStamp:7}}},
+		{"equal timestamps reversed",
+			groups{"a":{Description:[]byte("y"),TimeStamp:7}},
+			groups{"a":{Description:[]byte("x"),TimeStamp:7}},
+			groups{"a":{Description:[]byte("y"),TimeStamp:7}}},
+	}
+	many := groups{}
+	for i := 0; i<50; i++ { many[fmt.Sprintf("alt.many.%02d",i)] = GroupEntryNRT{TimeStamp:int64(i)} }
+	tests = append(tests,struct{
+		name          string
+		local,remote  groups
+		want          groups
+	}{"descend",many,groups{},many})
+	
+	for _,tt := range tests {
+		t.Run(tt.name,func(t *testing.T) {
+			local,remote := newTestNRT(t),newTestNRT(t)
+			for k,e := range tt.local { e := e; local.PutGroupNRT([]byte(k),&e) }
+			for k,e := range tt.remote { e := e; remote.PutGroupNRT([]byte(k),&e) }
+			s := &Syncer{Local:local,Remote:remote,Threshold:4}
+			if _,_,err := s.Sync(); err!=nil { t.Fatal(err) }
+			want := make(map[string]string)
+			for k,e := range tt.want { want[k] = string(e.Bytes()) }
+			for side,g := range map[string]*GroupNRT{"local":local,"remote":remote} {
+				if got := dumpNRT(t,g); !reflect.DeepEqual(got,want) { t.Errorf("%s = %q, want %q",side,got,want) }
+			}
+			// A second round has nothing left to do.
+			if pulled,pushed,err := s.Sync(); err!=nil || pulled+pushed>0 { t.Errorf("second round: pulled %d, pushed %d, %v",pulled,pushed,err) }
+		})
+	}
+}
+
+func TestSyncAbortsOnError(t *testing.T) {
+	local,remote := newTestNRT(t),newTestNRT(t)
+	local.PutGroupNRT([]byte("a"),&GroupEntryNRT{TimeStamp:1})
+	s := &Syncer{Local:local,Remote:failingSync{remote}}
+	if _,pushed,err := s.Sync(); err==nil || pushed!=0 { t.Errorf("pushed %d, err %v; want an error",pushed,err) }
+}
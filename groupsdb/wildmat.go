@@ -0,0 +1,112 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package groupsdb
+
+import "bytes"
+import "unicode/utf8"
+
+type wildmatPattern struct{
+	negate  bool
+	pattern []byte
+}
+
+// A parsed wildmat (RFC 3977, section 4), such as "comp.*,!comp.os.*".
+//
+// The pattern list is evaluated from left to right, the last matching pattern
+// wins. A name, that matches no pattern at all, does not match the wildmat.
+type Wildmat []wildmatPattern
+
+func ParseWildmat(s []byte) (w Wildmat) {
+	for _,p := range bytes.Split(s,[]byte(",")) {
+		p = bytes.TrimSpace(p)
+		neg := len(p)>0 && p[0]=='!'
+		if neg { p = p[1:] }
+		if len(p)==0 { continue }
+		w = append(w,wildmatPattern{neg,p})
+	}
+	return
+}
+
+func (w Wildmat) Match(name []byte) bool {
+	for i := len(w)-1; i>=0; i-- {
+		if wildmatMatch(w[i].pattern,name) { return !w[i].negate }
+	}
+	return false
+}
+
+// The longest literal prefix, every matching name starts with.
+func (w Wildmat) Prefix() []byte {
+	var prefix []byte
+	first := true
+	for _,p := range w {
+		if p.negate { continue }
+		lit := p.pattern
+		if i := bytes.IndexAny(lit,"*?"); i>=0 { lit = lit[:i] }
+		if first {
+			prefix,first = lit,false
+			continue
+		}
+		n := 0
+		for n<len(prefix) && n<len(lit) && prefix[n]==lit[n] { n++ }
+		prefix = prefix[:n]
+	}
+	return prefix
+}
+
+func wildmatMatch(pat, name []byte) bool {
+	// Position to resume from, after the last '*'.
+	sp,sn := -1,0
+	p,n := 0,0
+	for n<len(name) {
+		if p<len(pat) {
+			switch pat[p] {
+			case '*':
+				p++
+				sp,sn = p,n
+				continue
+			case '?':
+				_,l := utf8.DecodeRune(name[n:])
+				p++
+				n+=l
+				continue
+			default:
+				if pat[p]==name[n] {
+					p++
+					n++
+					continue
+				}
+			}
+		}
+		if sp<0 { return false }
+		// Let the last '*' swallow one more character.
+		_,l := utf8.DecodeRune(name[sn:])
+		sn += l
+		p,n = sp,sn
+	}
+	for p<len(pat) && pat[p]=='*' { p++ }
+	return p==len(pat)
+}
+
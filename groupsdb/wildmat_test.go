@@ -0,0 +1,82 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package groupsdb
+
+import "testing"
+
+func TestWildmatMatch(t *testing.T) {
+	for _,tc := range []struct{
+		wildmat, name string
+		want bool
+	}{
+		{"comp.lang.go","comp.lang.go",true},
+		{"comp.lang.go","comp.lang.golang",false},
+		{"comp.*","comp.lang.go",true},
+		{"comp.*","comp",false},
+		{"comp*","comp",true},
+		{"*.go","comp.lang.go",true},
+		{"*.go","comp.lang.go.misc",false},
+		{"comp.*.go","comp.lang.go",true},
+		{"comp.*.go","comp.go",false},
+		{"comp.lang.g?","comp.lang.go",true},
+		{"comp.lang.g?","comp.lang.g",false},
+		{"de.?bung","de.übung",true},
+		{"*a*a","banana",true},
+		{"*a*b","banana",false},
+		{"comp.*,!comp.os.*","comp.lang.go",true},
+		{"comp.*,!comp.os.*","comp.os.linux",false},
+		{"comp.*,!comp.os.*,comp.os.linux","comp.os.linux",true},
+		{"!comp.os.*,comp.*","comp.os.linux",true},
+		{" comp.* , !comp.os.* ","comp.os.linux",false},
+		{"alt.*,comp.*","alt.test",true},
+		{"","alt.test",false},
+		{"!alt.*","misc.test",false},
+	} {
+		if got := ParseWildmat([]byte(tc.wildmat)).Match([]byte(tc.name)); got!=tc.want {
+			t.Errorf("%q.Match(%q) = %v, want %v",tc.wildmat,tc.name,got,tc.want)
+		}
+	}
+}
+
+func TestWildmatPrefix(t *testing.T) {
+	for _,tc := range []struct{
+		wildmat, want string
+	}{
+		{"",""},
+		{"*",""},
+		{"comp.lang.go","comp.lang.go"},
+		{"comp.*","comp."},
+		{"comp.lang.g?","comp.lang.g"},
+		{"comp.*,!comp.os.*","comp."},
+		{"comp.lang.*,comp.os.*","comp."},
+		{"alt.*,comp.*",""},
+		{"comp.*,*.go",""},
+	} {
+		if got := ParseWildmat([]byte(tc.wildmat)).Prefix(); string(got)!=tc.want {
+			t.Errorf("%q.Prefix() = %q, want %q",tc.wildmat,got,tc.want)
+		}
+	}
+}
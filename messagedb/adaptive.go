@@ -0,0 +1,167 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "github.com/byte-mug/golibs/preciseio"
+import "github.com/byte-mug/golibs/serializer"
+import "github.com/boltdb/bolt"
+import "bytes"
+import "reflect"
+
+var tCompStats = []byte("GRP.COMP.STATS")
+
+// Decides whether compression pays off for a blob.
+//
+// Large blobs are sampled first, so incompressible content (yEnc, JPEG, ...)
+// is detected without compressing it completely. If the compressed size
+// exceeds Threshold times the original size, the blob is stored raw.
+type AdaptivePolicy struct{
+	SampleSize int     // Bytes to sample. Defaults to 16 KiB.
+	Threshold  float64 // Maximum ratio (stored/raw). Defaults to 0.95.
+}
+
+func (a *AdaptivePolicy) sampleSize() int {
+	if a.SampleSize<=0 { return 16<<10 }
+	return a.SampleSize
+}
+func (a *AdaptivePolicy) threshold() float64 {
+	if a.Threshold<=0 { return 0.95 }
+	return a.Threshold
+}
+
+// Returns the number of bytes, the content of a blob occupies.
+func blobStoredSize(b AbstractBlob) int {
+	switch v := b.(type) {
+	case *BlobDirect: return len(v.Content)
+	case *BlobLz4Compressed: return len(v.Lz4Content)
+	case *BlobCompressed: return len(v.Content)
+	case *BlobDictCompressed: return len(v.Content)
+	case *BlobEncrypted: return len(v.Content)
+	}
+	return 0
+}
+
+func (a *AdaptivePolicy) pays(raw, stored int) bool {
+	return float64(stored) <= float64(raw)*a.threshold()
+}
+
+// Compresses b using c, unless compression doesn't pay off.
+func (a *AdaptivePolicy) Compress(c CompressionHint, b AbstractBlob) (res AbstractBlob, skipped bool) {
+	return a.CompressWith(c,b,CompressionHint.Compress)
+}
+
+// Like Compress, but uses the given compression function.
+//
+// If a is nil, it just calls compress.
+func (a *AdaptivePolicy) CompressWith(c CompressionHint, b AbstractBlob, compress func(CompressionHint,AbstractBlob) AbstractBlob) (res AbstractBlob, skipped bool) {
+	if a==nil || c==CH_None { return compress(c,b),false }
+	bd,ok := b.(*BlobDirect)
+	if !ok || bd==nil { return compress(c,b),false }
+	l := len(bd.Content)
+	s := a.sampleSize()
+	if l>2*s {
+		// Sample from the middle, to skip over headers of binary content.
+		sample := bd.Content[(l-s)/2:][:s]
+		if !a.pays(s,blobStoredSize(compress(c,&BlobDirect{sample}))) { return b,true }
+	}
+	res = compress(c,b)
+	if res==nil || blobStoredSize(res)==0 { return res,false }
+	if res!=b && !a.pays(l,blobStoredSize(res)) { return b,true }
+	return res,false
+}
+
+// Per-group compression statistics.
+type CompressionStats struct{
+	Blobs       int64 // Number of blobs stored (inline or in dayfiles).
+	Skipped     int64 // Number of blobs stored raw, because compression didn't pay off.
+	RawBytes    int64 // Uncompressed size.
+	StoredBytes int64 // Stored size.
+}
+var ce_CompressionStats = serializer.WithInline(new(CompressionStats)).
+	Field("Blobs").
+	Field("Skipped").
+	Field("RawBytes").
+	Field("StoredBytes")
+//
+
+func (s *CompressionStats) add(raw, stored AbstractBlob, skipped bool) {
+	if raw==nil || stored==nil { return }
+	s.Blobs++
+	if skipped { s.Skipped++ }
+	s.RawBytes += int64(blobStoredSize(raw))
+	s.StoredBytes += int64(blobStoredSize(stored))
+}
+
+func parseCompressionStats(b []byte) *CompressionStats {
+	s := new(CompressionStats)
+	if len(b)==0 { return s }
+	err := ce_CompressionStats.Read(preciseio.PreciseReader{bytes.NewReader(b)}, reflect.ValueOf(s).Elem())
+	if err!=nil { return new(CompressionStats) }
+	return s
+}
+func (s *CompressionStats) bytes() []byte {
+	buf := new(bytes.Buffer)
+	w := preciseio.PreciseWriterFromPool()
+	defer w.PutToPool()
+	w.W = buf
+	ce_CompressionStats.Write(w, reflect.ValueOf(s).Elem())
+	return buf.Bytes()
+}
+
+func (g *GrpArtDB) updateCompressionStats(tx *bolt.Tx, group []byte, upd *CompressionStats) error {
+	if upd.Blobs==0 { return nil }
+	bkt := tx.Bucket(tCompStats)
+	s := parseCompressionStats(bkt.Get(group))
+	s.Blobs       += upd.Blobs
+	s.Skipped     += upd.Skipped
+	s.RawBytes    += upd.RawBytes
+	s.StoredBytes += upd.StoredBytes
+	return bkt.Put(group,s.bytes())
+}
+
+// Stores b in a dayfile of node, like node.AddDayfileBlob, but compresses it
+// according to the Adaptive policy of g first and records the result in the
+// compression statistics of group. node receives the blob already compressed.
+func (g *GrpArtDB) AddDayfileBlob(group []byte, node IDayfileNode, dayid int, ch CompressionHint, b AbstractBlob) AbstractBlob {
+	cb,skipped := g.Adaptive.Compress(ch,b)
+	loc := node.AddDayfileBlob(dayid,CH_None,cb)
+	if loc==nil || loc.IsDirect() { return loc } // Counted by PutArticle.
+	var stats CompressionStats
+	stats.add(b,cb,skipped)
+	g.DB.Batch(func(tx *bolt.Tx) error {
+		return g.updateCompressionStats(tx,group,&stats)
+	})
+	return loc
+}
+
+// Returns the compression statistics of a group.
+func (g *GrpArtDB) GetCompressionStats(group []byte) (stats *CompressionStats) {
+	g.DB.View(func(tx *bolt.Tx) error {
+		stats = parseCompressionStats(tx.Bucket(tCompStats).Get(group))
+		return nil
+	})
+	return
+}
@@ -0,0 +1,52 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "bytes"
+import "math/rand"
+import "testing"
+
+// Content stored in dayfiles feeds the compression stats of its group.
+func TestDayfileCompressionStats(t *testing.T) {
+	d := newTestDedup(t)
+	g := &GrpArtDB{DB:d.DB,Adaptive:new(AdaptivePolicy)}
+	if err := g.Initialize(); err!=nil { t.Fatal(err) }
+	text := &BlobDirect{bytes.Repeat([]byte("compressible text\r\n"),1000)}
+	noise := make([]byte,64<<10)
+	rand.New(rand.NewSource(1)).Read(noise)
+	
+	group := []byte("alt.test")
+	for _,b := range []AbstractBlob{text,&BlobDirect{noise}} {
+		loc := g.AddDayfileBlob(group,d.IDayfileNode,1,CH_Deflate,b)
+		if _,ok := loc.(*BlobLocation); !ok { t.Fatalf("stored as %T",loc) }
+		if res := Decompress(d.ReadDayfileBlob(loc)); !bytes.Equal(res.(*BlobDirect).Content,b.(*BlobDirect).Content) { t.Error("content changed") }
+	}
+	st := g.GetCompressionStats(group)
+	if st.Blobs!=2 || st.Skipped!=1 { t.Errorf("blobs %d, skipped %d, want 2, 1",st.Blobs,st.Skipped) }
+	if raw := int64(len(text.Content)+len(noise)); st.RawBytes!=raw { t.Errorf("raw bytes %d, want %d",st.RawBytes,raw) }
+	if st.StoredBytes>=st.RawBytes { t.Errorf("stored bytes %d, raw bytes %d",st.StoredBytes,st.RawBytes) }
+	if other := g.GetCompressionStats([]byte("alt.other")); other.Blobs!=0 { t.Errorf("stats leaked into another group: %v",other) }
+}
@@ -0,0 +1,242 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "github.com/byte-mug/golibs/preciseio"
+import "github.com/byte-mug/golibs/serializer"
+import "github.com/boltdb/bolt"
+import "github.com/nu7hatch/gouuid"
+import "encoding/binary"
+import "errors"
+import "bufio"
+import "bytes"
+import "io"
+import "reflect"
+
+// Archive layout:
+//
+//	header: magic "ADB-ARCH", [2] version, [16] source node, [8] first day, [8] last day
+//	records: [1] tag, uvarint length, serialized record
+//
+// Tag 'a' is an ArchiveArticle, tag 'e' ends the archive.
+const archiveMagic = "ADB-ARCH"
+const archiveVersion = 1
+const archiveHeaderSize = 8+2+16+8+8
+
+// Upper bound of the length of a record. Larger lengths indicate a corrupt
+// archive, rather than a huge article.
+const archiveMaxRecord = 1<<30
+
+var EArchive = errors.New("not an article archive")
+var EArchiveRecord = errors.New("archive record too large")
+
+const (
+	AF_HeadInDayfile byte = 1<<iota
+	AF_BodyInDayfile
+)
+
+// An article, as stored in an archive. Head and Body are direct blobs.
+type ArchiveArticle struct{
+	Group  []byte
+	Number int64
+	Xover  ArticleXover
+	Redir  *ArticleRedirect
+	DayID  int
+	Flags  byte
+	Head   AbstractBlob
+	Body   AbstractBlob
+}
+var ce_ArchiveArticle = serializer.WithInline(new(ArchiveArticle)).
+	Field("Group").
+	Field("Number").
+	FieldWith("Xover",ce_ArticleXoverStruct).
+	FieldWith("Redir",ce_ArticleRedirectPtr).
+	Field("DayID").
+	Field("Flags").
+	FieldWith("Head",ce_AbstractBlob).
+	FieldWith("Body",ce_AbstractBlob)
+//
+
+// Implemented by IDayfileNode wrappers (like DedupDayfileNode), whose blob
+// references aren't BlobLocations.
+type IDayfileResolver interface{
+	// Returns the BlobLocation behind b, or nil.
+	ResolveDayfileBlob(b AbstractBlob) *BlobLocation
+}
+
+func (d *DedupDayfileNode) ResolveDayfileBlob(b AbstractBlob) *BlobLocation {
+	ref,ok := b.(*BlobContentRef)
+	if !ok || ref==nil { return nil }
+	bl,_ := d.lookup(ref.Hash).(*BlobLocation)
+	return bl
+}
+
+func resolveDayfileBlob(node IDayfileNode, b AbstractBlob) *BlobLocation {
+	if bl,ok := b.(*BlobLocation); ok { return bl }
+	if r,ok := node.(IDayfileResolver); ok { return r.ResolveDayfileBlob(b) }
+	return nil
+}
+
+func writeArchiveRecord(w *bufio.Writer, tag byte, data []byte) error {
+	var l [binary.MaxVarintLen64]byte
+	w.WriteByte(tag)
+	w.Write(l[:binary.PutUvarint(l[:],uint64(len(data)))])
+	_,err := w.Write(data)
+	return err
+}
+
+// Writes all articles, whose head or body is stored in the dayfiles first..last
+// of the node, into an archive.
+//
+// The content is written decrypted, as returned by GetArticle and
+// ReadDayfileBlob, so the archive must be protected like the plaintext.
+// ImportArchive encrypts it again, if the Keyrings are set.
+func (g *GrpArtDB) ExportArchive(out io.Writer, node IDayfileNode, first, last int) (n int,err error) {
+	bw := bufio.NewWriter(out)
+	hdr := make([]byte,archiveHeaderSize)
+	copy(hdr,archiveMagic)
+	binary.BigEndian.PutUint16(hdr[8:],archiveVersion)
+	if id := node.GetDayfileNodeID(); id!=nil { copy(hdr[10:26],id[:]) }
+	binary.BigEndian.PutUint64(hdr[26:],uint64(first))
+	binary.BigEndian.PutUint64(hdr[34:],uint64(last))
+	if _,err = bw.Write(hdr); err!=nil { return }
+	
+	buf := new(bytes.Buffer)
+	w := preciseio.PreciseWriterFromPool()
+	defer w.PutToPool()
+	w.W = buf
+	
+	inRange := func(b AbstractBlob) (int,bool) {
+		bl := resolveDayfileBlob(node,b)
+		if bl==nil || bl.DayID<first || bl.DayID>last { return 0,false }
+		return bl.DayID,true
+	}
+	
+	for _,group := range g.groupBuckets(tLocal) {
+		var nums []int64
+		g.DB.View(func(tx *bolt.Tx) error {
+			bkt := tx.Bucket(tLocal).Bucket(group)
+			if bkt==nil { return nil }
+			return bkt.ForEach(func(k, v []byte) error {
+				nums = append(nums,decode64(k))
+				return nil
+			})
+		})
+		for _,num := range nums {
+			headPtr,bodyPtr,ok := g.GetArticle(group,num,true,true)
+			if !ok { continue }
+			rec := ArchiveArticle{Group:group,Number:num,Head:headPtr,Body:bodyPtr}
+			var hin,bin bool
+			var day int
+			if d,ok := inRange(headPtr); ok { hin,day = true,d }
+			if d,ok := inRange(bodyPtr); ok { bin,day = true,d }
+			if !(hin||bin) { continue }
+			rec.DayID = day
+			if headPtr!=nil && !headPtr.IsDirect() {
+				rec.Head = node.ReadDayfileBlob(headPtr)
+				if rec.Head==nil { return n,errors.New("can't read head") }
+				rec.Flags |= AF_HeadInDayfile
+			}
+			if bodyPtr!=nil && !bodyPtr.IsDirect() {
+				rec.Body = node.ReadDayfileBlob(bodyPtr)
+				if rec.Body==nil { return n,errors.New("can't read body") }
+				rec.Flags |= AF_BodyInDayfile
+			}
+			if xo := g.GetXover(group,num,num,1); len(xo)==1 { rec.Xover = xo[0].Xover }
+			rec.Redir = g.getRedirect(group,num)
+			
+			buf.Reset()
+			if err = ce_ArchiveArticle.Write(w,reflect.ValueOf(rec)); err!=nil { return }
+			if err = writeArchiveRecord(bw,'a',buf.Bytes()); err!=nil { return }
+			n++
+		}
+	}
+	if err = writeArchiveRecord(bw,'e',encode64(int64(n))); err!=nil { return }
+	err = bw.Flush()
+	return
+}
+
+func (g *GrpArtDB) getRedirect(group []byte, num int64) (redir *ArticleRedirect) {
+	redir = new(ArticleRedirect)
+	g.DB.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(tRedir).Bucket(group)
+		if bkt==nil { return nil }
+		ce_ArticleRedirect.Read(preciseio.PreciseReader{bytes.NewReader(bkt.Get(encode64(num)))}, reflect.ValueOf(redir).Elem())
+		return nil
+	})
+	return
+}
+
+// Reads the header of an archive. Returns the source node and the day range.
+func readArchiveHeader(r io.Reader) (node *uuid.UUID, first, last int, err error) {
+	hdr := make([]byte,archiveHeaderSize)
+	if _,err = io.ReadFull(r,hdr); err!=nil { return }
+	if string(hdr[:8])!=archiveMagic || binary.BigEndian.Uint16(hdr[8:])>archiveVersion {
+		err = EArchive
+		return
+	}
+	node = new(uuid.UUID)
+	copy(node[:],hdr[10:26])
+	first = int(int64(binary.BigEndian.Uint64(hdr[26:])))
+	last = int(int64(binary.BigEndian.Uint64(hdr[34:])))
+	return
+}
+
+// Imports an archive. The blobs are stored via g.AddDayfileBlob (into the
+// same day IDs of node) and the articles are stored with PutArticle, which rewrites
+// their GRP.ART.LOCAL pointers.
+func (g *GrpArtDB) ImportArchive(in io.Reader, node IDayfileNode) (n int,err error) {
+	br := bufio.NewReader(in)
+	if _,_,_,err = readArchiveHeader(br); err!=nil { return }
+	for {
+		var tag byte
+		var l uint64
+		if tag,err = br.ReadByte(); err!=nil { return }
+		if l,err = binary.ReadUvarint(br); err!=nil { return }
+		if l>archiveMaxRecord { return n,EArchiveRecord }
+		data := make([]byte,l)
+		if _,err = io.ReadFull(br,data); err!=nil { return }
+		switch tag {
+		case 'e': return
+		case 'a':
+		default: continue // Unknown record.
+		}
+		rec := new(ArchiveArticle)
+		if err = ce_ArchiveArticle.Read(preciseio.PreciseReader{bytes.NewReader(data)},reflect.ValueOf(rec).Elem()); err!=nil { return }
+		ap := &ArticlePosting{Xover:rec.Xover,Redir:rec.Redir,Head:rec.Head,Body:rec.Body}
+		if ap.Redir==nil { ap.Redir = new(ArticleRedirect) }
+		if rec.Flags&AF_HeadInDayfile!=0 {
+			ap.Head = g.AddDayfileBlob(rec.Group,node,rec.DayID,CH_None,rec.Head)
+			if ap.Head==nil { return n,errors.New("can't store head") }
+		}
+		if rec.Flags&AF_BodyInDayfile!=0 {
+			ap.Body = g.AddDayfileBlob(rec.Group,node,rec.DayID,CH_None,rec.Body)
+			if ap.Body==nil { return n,errors.New("can't store body") }
+		}
+		if !g.PutArticle(rec.Group,rec.Number,ap) { return n,errors.New("can't store article") }
+		n++
+	}
+}
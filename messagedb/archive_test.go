@@ -0,0 +1,140 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "bytes"
+import "encoding/binary"
+import "fmt"
+import "testing"
+
+type archiveTestNode struct{
+	g   *GrpArtDB
+	dfc *DayfileCache
+}
+
+func newArchiveTestNode(t *testing.T, keys *Keyring) *archiveTestNode {
+	n := &archiveTestNode{
+		g: &GrpArtDB{DB:openTestDB(t),Keyring:keys},
+		dfc: &DayfileCache{Folder:t.TempDir(),Keyring:keys},
+	}
+	if err := n.g.Initialize(); err!=nil { t.Fatal(err) }
+	if err := n.dfc.Init(nil); err!=nil { t.Fatal(err) }
+	t.Cleanup(func(){ n.dfc.Close() })
+	return n
+}
+
+// Returns the content of a blob, reading it from the dayfiles, if needed.
+func (n *archiveTestNode) content(b AbstractBlob) []byte {
+	if b!=nil && !b.IsDirect() { b = n.dfc.ReadDayfileBlob(b) }
+	bd,_ := Decompress(b).(*BlobDirect)
+	if bd==nil { return nil }
+	return bd.Content
+}
+
+type archiveTestArticle struct{
+	num        int64
+	day        int  // Dayfile, or -1 for inline content.
+	headInline bool // Store the head inline, even if day is set.
+	exported   bool
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	group := []byte("alt.test")
+	articles := []archiveTestArticle{
+		{1,1,false,true},
+		{2,2,true,true},
+		{3,5,false,false}, // Outside of the exported range.
+		{4,-1,false,false}, // Inline only.
+	}
+	for _,tc := range []struct{
+		name string
+		keys func(t *testing.T) *Keyring
+	}{
+		{"plain",func(t *testing.T) *Keyring { return nil }},
+		{"encrypted",func(t *testing.T) *Keyring { return testKeyring(t,"k1") }},
+	} {
+		t.Run(tc.name,func(t *testing.T) {
+			src := newArchiveTestNode(t,tc.keys(t))
+			dst := newArchiveTestNode(t,tc.keys(t))
+			want := 0
+			for _,a := range articles {
+				head := &BlobDirect{[]byte(fmt.Sprintf("Subject: %d\r\n",a.num))}
+				body := &BlobDirect{[]byte(fmt.Sprintf("body %d\r\n",a.num))}
+				ap := &ArticlePosting{Redir:&ArticleRedirect{group,a.num},Head:head,Body:body}
+				if a.day>=0 {
+					ap.Body = src.dfc.AddDayfileBlob(a.day,CH_None,body)
+					if !a.headInline { ap.Head = src.dfc.AddDayfileBlob(a.day,CH_None,head) }
+				}
+				if !src.g.PutArticle(group,a.num,ap) { t.Fatalf("PutArticle(%d) failed",a.num) }
+				if a.exported { want++ }
+			}
+			
+			buf := new(bytes.Buffer)
+			n,err := src.g.ExportArchive(buf,src.dfc,1,2)
+			if err!=nil || n!=want { t.Fatalf("ExportArchive = %d,%v, want %d",n,err,want) }
+			n,err = dst.g.ImportArchive(bytes.NewReader(buf.Bytes()),dst.dfc)
+			if err!=nil || n!=want { t.Fatalf("ImportArchive = %d,%v, want %d",n,err,want) }
+			
+			for _,a := range articles {
+				h,b,ok := dst.g.GetArticle(group,a.num,true,true)
+				if ok!=a.exported { t.Errorf("article %d: imported = %v, want %v",a.num,ok,a.exported); continue }
+				if !ok { continue }
+				sh,sb,_ := src.g.GetArticle(group,a.num,true,true)
+				if !bytes.Equal(dst.content(h),src.content(sh)) { t.Errorf("article %d: head %q",a.num,dst.content(h)) }
+				if !bytes.Equal(dst.content(b),src.content(sb)) { t.Errorf("article %d: body %q",a.num,dst.content(b)) }
+				if bl,_ := b.(*BlobLocation); bl==nil || bl.DayID!=a.day { t.Errorf("article %d: body stored at %v, want day %d",a.num,b,a.day) }
+				if a.headInline && dst.g.Keyring!=nil {
+					raw := readRawBlob(t,dst.g.DB,tHead,group,a.num)
+					if _,ok := raw.(*BlobEncrypted); !ok { t.Errorf("article %d: head stored as %T, want *BlobEncrypted",a.num,raw) }
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveMalformed(t *testing.T) {
+	valid := new(bytes.Buffer)
+	src := newArchiveTestNode(t,nil)
+	if _,err := src.g.ExportArchive(valid,src.dfc,0,0); err!=nil { t.Fatal(err) }
+	hdr := valid.Bytes()[:archiveHeaderSize]
+	
+	var l [binary.MaxVarintLen64]byte
+	huge := append(append(append([]byte{},hdr...),'a'),l[:binary.PutUvarint(l[:],archiveMaxRecord+1)]...)
+	
+	for _,tc := range []struct{
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty",valid.Bytes(),nil},
+		{"magic",append([]byte("NOT-ARCH"),valid.Bytes()[8:]...),EArchive},
+		{"huge record",huge,EArchiveRecord},
+	} {
+		dst := newArchiveTestNode(t,nil)
+		n,err := dst.g.ImportArchive(bytes.NewReader(tc.data),dst.dfc)
+		if err!=tc.err || n!=0 { t.Errorf("%s: ImportArchive = %d,%v, want 0,%v",tc.name,n,err,tc.err) }
+	}
+}
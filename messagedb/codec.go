@@ -0,0 +1,188 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "github.com/golang/snappy"
+import "github.com/klauspost/compress/zstd"
+import "compress/flate"
+import "bytes"
+import "errors"
+import "sync"
+import "io"
+
+var EUCLen = errors.New("uncompressed length mismatch")
+
+// The largest uncompressed length, a compressed blob may claim.
+const maxUCLen = 0x7E000000
+
+const (
+	CH_Deflate CompressionHint = 'd'
+	CH_Snappy  CompressionHint = 's'
+	CH_Zstd    CompressionHint = 'Z'
+)
+
+// A compression codec, used for every CompressionHint except LZ4 (which uses
+// BlobLz4Compressed for historical reasons).
+type Codec struct{
+	Name string
+	
+	// Compresses src. A nil result means "not compressible".
+	Compress   func(src []byte) ([]byte,error)
+	
+	// Decompresses src. uclen is the length of the uncompressed content, as
+	// claimed by the blob. It is untrusted, so codecs must not allocate it up
+	// front, unless they verified it against src.
+	Decompress func(src []byte, uclen int) ([]byte,error)
+}
+
+var codecMutex sync.RWMutex
+var codecs = make(map[CompressionHint]*Codec)
+
+// Registers a codec for a compression hint. Compressed blobs store the hint
+// as tag, so the hint of a codec must never be reused for a different codec.
+func RegisterCodec(c CompressionHint, codec *Codec) {
+	codecMutex.Lock(); defer codecMutex.Unlock()
+	codecs[c] = codec
+}
+
+// Returns the codec for a compression hint, or nil.
+func LookupCodec(c CompressionHint) *Codec {
+	codecMutex.RLock(); defer codecMutex.RUnlock()
+	return codecs[c]
+}
+
+// Parses a compression hint from its name ("none", "lz4", "lz4hc" or the
+// name of a registered codec).
+func ParseCompressionHint(name string) (CompressionHint,bool) {
+	switch name {
+	case "","none": return CH_None,true
+	case "lz4": return CH_LZ4,true
+	case "lz4hc": return CH_LZ4_HC,true
+	}
+	codecMutex.RLock(); defer codecMutex.RUnlock()
+	for c,codec := range codecs {
+		if codec.Name==name { return c,true }
+	}
+	return CH_None,false
+}
+
+func (c CompressionHint) compressCodec(bd *BlobDirect) AbstractBlob {
+	codec := LookupCodec(c)
+	if codec==nil { return bd }
+	dest,err := codec.Compress(bd.Content)
+	if err!=nil || len(dest)==0 || len(dest)>=len(bd.Content) { return bd }
+	return &BlobCompressed{c,len(bd.Content),dest}
+}
+
+func decompressCodec(b *BlobCompressed) AbstractBlob {
+	codec := LookupCodec(b.Codec)
+	if codec==nil { return nil }
+	if b.UCLen>maxUCLen || b.UCLen<0 { return nil }
+	buf,err := codec.Decompress(b.Content,b.UCLen)
+	if err!=nil || len(buf)!=b.UCLen { return nil }
+	return &BlobDirect{buf}
+}
+
+// Per-group compression hints, matched by group name prefix.
+type GroupCompression struct{
+	Prefix []byte
+	Head   CompressionHint
+	Body   CompressionHint
+}
+
+// A list of per-group compression hints. The longest matching prefix wins.
+type CompressionPolicy []GroupCompression
+
+func (p CompressionPolicy) Lookup(group []byte) (head, body CompressionHint, ok bool) {
+	best := -1
+	for _,gc := range p {
+		if len(gc.Prefix)<=best || !bytes.HasPrefix(group,gc.Prefix) { continue }
+		best = len(gc.Prefix)
+		head,body,ok = gc.Head,gc.Body,true
+	}
+	return
+}
+
+// ----------- Builtin codecs ----------------------
+
+// Reads exactly uclen bytes from r. The buffer grows with the content read,
+// instead of being allocated from uclen.
+func readUncompressed(r io.Reader, uclen int) ([]byte,error) {
+	buf := new(bytes.Buffer)
+	_,err := buf.ReadFrom(io.LimitReader(r,int64(uclen)+1))
+	if err!=nil { return nil,err }
+	if buf.Len()!=uclen { return nil,EUCLen }
+	return buf.Bytes(),nil
+}
+
+func deflateCompress(src []byte) ([]byte,error) {
+	buf := new(bytes.Buffer)
+	w,err := flate.NewWriter(buf,flate.BestCompression)
+	if err!=nil { return nil,err }
+	_,err = w.Write(src)
+	if err!=nil { return nil,err }
+	err = w.Close()
+	if err!=nil { return nil,err }
+	return buf.Bytes(),nil
+}
+func deflateDecompress(src []byte, uclen int) ([]byte,error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	return readUncompressed(r,uclen)
+}
+
+func snappyCompress(src []byte) ([]byte,error) {
+	return snappy.Encode(nil,src),nil
+}
+// A snappy element of 3 bytes expands to at most 64 bytes.
+const snappyMaxRatio = 22
+
+func snappyDecompress(src []byte, uclen int) ([]byte,error) {
+	if uclen/snappyMaxRatio>len(src) { return nil,snappy.ErrCorrupt }
+	l,err := snappy.DecodedLen(src)
+	if err!=nil { return nil,err }
+	if l!=uclen { return nil,snappy.ErrCorrupt }
+	return snappy.Decode(make([]byte,uclen),src)
+}
+
+var zstdEncoder,_ = zstd.NewWriter(nil,zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+var zstdDecoder,_ = zstd.NewReader(nil,zstd.WithDecoderMaxMemory(maxUCLen))
+
+func zstdCompress(src []byte) ([]byte,error) {
+	return zstdEncoder.EncodeAll(src,nil),nil
+}
+func zstdDecompress(src []byte, uclen int) ([]byte,error) {
+	// The frame header may state the content size as well; it has to agree.
+	var h zstd.Header
+	if h.Decode(src)==nil && h.HasFCS && h.FrameContentSize!=uint64(uclen) { return nil,EUCLen }
+	return zstdDecoder.DecodeAll(src,nil)
+}
+
+func init() {
+	RegisterCodec(CH_Deflate,&Codec{"deflate",deflateCompress,deflateDecompress})
+	RegisterCodec(CH_Snappy ,&Codec{"snappy" ,snappyCompress ,snappyDecompress })
+	RegisterCodec(CH_Zstd   ,&Codec{"zstd"   ,zstdCompress   ,zstdDecompress   })
+}
@@ -0,0 +1,50 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "bytes"
+import "testing"
+
+func TestCodecRoundTrip(t *testing.T) {
+	content := bytes.Repeat([]byte("Subject: Re: Re: Re: codecs\r\n"),100)
+	for _,c := range []CompressionHint{CH_Deflate,CH_Snappy,CH_Zstd} {
+		cb,ok := c.Compress(&BlobDirect{content}).(*BlobCompressed)
+		if !ok { t.Errorf("%c: not compressed",c); continue }
+		if res,ok := Decompress(cb).(*BlobDirect); !ok || !bytes.Equal(res.Content,content) { t.Errorf("%c: content changed",c) }
+	}
+}
+
+// A blob, that claims a wrong (e.g. huge) uncompressed length, is rejected.
+func TestCodecUCLen(t *testing.T) {
+	content := bytes.Repeat([]byte("x"),1000)
+	for _,c := range []CompressionHint{CH_Deflate,CH_Snappy,CH_Zstd} {
+		cb := c.Compress(&BlobDirect{content}).(*BlobCompressed)
+		for _,uclen := range []int{maxUCLen,maxUCLen+1,len(content)+1,len(content)-1,-1} {
+			b := &BlobCompressed{cb.Codec,uclen,cb.Content}
+			if res := Decompress(b); res!=nil { t.Errorf("%c: uclen %d accepted",c,uclen) }
+		}
+	}
+}
@@ -0,0 +1,339 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "github.com/byte-mug/golibs/preciseio"
+import "github.com/boltdb/bolt"
+import "crypto/aes"
+import "crypto/cipher"
+import "crypto/rand"
+import "encoding/hex"
+import "bufio"
+import "bytes"
+import "fmt"
+import "os"
+import "reflect"
+import "strings"
+import "time"
+
+func encodeBlob(b AbstractBlob) []byte {
+	buf := new(bytes.Buffer)
+	w := preciseio.PreciseWriterFromPool()
+	defer w.PutToPool()
+	w.W = buf
+	if ce_AbstractBlob.Write(w, reflect.ValueOf(b))!=nil { return nil }
+	return buf.Bytes()
+}
+func decodeBlob(b []byte) (res AbstractBlob) {
+	if ce_AbstractBlob.Read(preciseio.PreciseReader{bytes.NewReader(b)}, reflect.ValueOf(&res).Elem())!=nil { return nil }
+	return
+}
+
+// A set of AEAD keys (AES-GCM) used to encrypt content at rest.
+//
+// The keyring file contains one key per line: "<key-id> <hex-key>", where the
+// key is 16, 24 or 32 bytes long. Empty lines and lines starting with '#' are
+// ignored. The last key in the file is used to encrypt new content, so keys
+// are rotated by appending a new key.
+type Keyring struct{
+	Current []byte
+	keys map[string]cipher.AEAD
+}
+
+func LoadKeyring(path string) (*Keyring,error) {
+	f,err := os.Open(path)
+	if err!=nil { return nil,err }
+	defer f.Close()
+	k := &Keyring{keys:make(map[string]cipher.AEAD)}
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		t := strings.TrimSpace(s.Text())
+		if t=="" || t[0]=='#' { continue }
+		fields := strings.Fields(t)
+		if len(fields)!=2 { return nil,fmt.Errorf("%s:%d: expected <key-id> <hex-key>",path,line) }
+		raw,err := hex.DecodeString(fields[1])
+		if err!=nil { return nil,fmt.Errorf("%s:%d: %v",path,line,err) }
+		err = k.AddKey([]byte(fields[0]),raw)
+		if err!=nil { return nil,fmt.Errorf("%s:%d: %v",path,line,err) }
+	}
+	if err := s.Err(); err!=nil { return nil,err }
+	return k,nil
+}
+
+// Adds a key and makes it the current key.
+func (k *Keyring) AddKey(id, key []byte) error {
+	block,err := aes.NewCipher(key)
+	if err!=nil { return err }
+	aead,err := cipher.NewGCM(block)
+	if err!=nil { return err }
+	if k.keys==nil { k.keys = make(map[string]cipher.AEAD) }
+	k.keys[string(id)] = aead
+	k.Current = cloneb(id)
+	return nil
+}
+
+// Encrypts a direct blob with the current key.
+//
+// If k is nil or has no keys, or if b isn't direct, it returns b unmodified.
+func (k *Keyring) Encrypt(b AbstractBlob) AbstractBlob { return k.EncryptWith(b,nil) }
+
+// Like Encrypt, but binds the ciphertext to ad (additional data), so that only
+// DecryptWith with the same ad can decrypt it.
+func (k *Keyring) EncryptWith(b AbstractBlob, ad []byte) AbstractBlob {
+	if k==nil || b==nil || !b.IsDirect() { return b }
+	if _,ok := b.(*BlobEncrypted); ok { return b }
+	aead := k.keys[string(k.Current)]
+	if aead==nil { return b }
+	plain := encodeBlob(b)
+	if plain==nil { return b }
+	nonce := make([]byte,aead.NonceSize())
+	if _,err := rand.Read(nonce); err!=nil { return nil }
+	return &BlobEncrypted{k.Current,nonce,aead.Seal(nil,nonce,plain,additionalData(k.Current,ad))}
+}
+
+// Decrypts a blob.
+//
+// If b isn't encrypted, it returns b unmodified.
+// If b is encrypted, but the key is unknown or b is corrupted, it returns nil.
+func (k *Keyring) Decrypt(b AbstractBlob) AbstractBlob { return k.DecryptWith(b,nil) }
+
+// Like Decrypt, for blobs encrypted by EncryptWith.
+func (k *Keyring) DecryptWith(b AbstractBlob, ad []byte) AbstractBlob {
+	eb,ok := b.(*BlobEncrypted)
+	if !ok { return b }
+	if k==nil || eb==nil { return nil }
+	aead := k.keys[string(eb.KeyID)]
+	if aead==nil || len(eb.Nonce)!=aead.NonceSize() { return nil }
+	plain,err := aead.Open(nil,eb.Nonce,eb.Content,additionalData(eb.KeyID,ad))
+	if err!=nil { return nil }
+	res := decodeBlob(plain)
+	if _,nested := res.(*BlobEncrypted); nested { return nil }
+	return res
+}
+
+func additionalData(keyID, ad []byte) []byte {
+	if len(ad)==0 { return keyID }
+	return append(append(cloneb(keyID),0),ad...)
+}
+
+// The additional data of inline content. It binds the ciphertext to the table
+// (GRP.ART.HEAD or GRP.ART.BODY), the group and the article number, so that it
+// can't be moved to another article unnoticed.
+func articleAD(table, group []byte, num int64) []byte {
+	return append(append(append(cloneb(table),0),group...),encode64(num)...)
+}
+
+// Reports whether b needs to be re-encrypted with the current key.
+func (k *Keyring) stale(b AbstractBlob) bool {
+	eb,ok := b.(*BlobEncrypted)
+	return ok && eb!=nil && !bytes.Equal(eb.KeyID,k.Current)
+}
+
+func (g *GrpArtDB) groupBuckets(table []byte) (groups [][]byte) {
+	g.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(table).ForEach(func(k, v []byte) error {
+			if v==nil { groups = append(groups,cloneb(k)) }
+			return nil
+		})
+	})
+	return
+}
+
+func (g *GrpArtDB) rotateInline(k *Keyring, table, group []byte) (n int,err error) {
+	err = g.DB.Update(func(tx *bolt.Tx) error {
+		n = 0
+		bkt := tx.Bucket(table).Bucket(group)
+		if bkt==nil { return nil }
+		var keys,values [][]byte
+		bkt.ForEach(func(key, v []byte) error {
+			b := decodeBlob(v)
+			if !k.stale(b) { return nil }
+			ad := articleAD(table,group,decode64(key))
+			b = k.EncryptWith(k.DecryptWith(b,ad),ad)
+			if b==nil { return nil }
+			keys = append(keys,cloneb(key))
+			values = append(values,encodeBlob(b))
+			return nil
+		})
+		for i,key := range keys {
+			if err := bkt.Put(key,values[i]); err!=nil { return err }
+		}
+		n = len(keys)
+		return nil
+	})
+	return
+}
+
+// Appends a copy of a dayfile blob, encrypted with the current key, if it is
+// stale. Returns nil, if it isn't.
+func rotateBlob(k *Keyring, dfc *DayfileCache, b AbstractBlob) AbstractBlob {
+	bl,ok := b.(*BlobLocation)
+	if !ok || bl==nil || bl.Node==nil || dfc.NodeID==nil || *bl.Node!=*dfc.NodeID { return nil }
+	df := dfc.GetFile(bl.DayID)
+	if df==nil { return nil }
+	raw,err := df.readRaw(bl)
+	df.Drop()
+	if err!=nil || !k.stale(raw) { return nil }
+	return dfc.AddDayfileBlob(bl.DayID,CH_None,k.Decrypt(raw))
+}
+
+// Rotates the given dayfile blobs. The result maps the encoding of every
+// rotated blob to its new copy. The copies are written outside of any
+// transaction; the pointers are swapped afterwards.
+func rotateBlobs(k *Keyring, dfc *DayfileCache, blobs []AbstractBlob) map[string]AbstractBlob {
+	moved := make(map[string]AbstractBlob)
+	for _,b := range blobs {
+		key := string(encodeBlob(b))
+		if _,ok := moved[key]; ok { continue }
+		if nb := rotateBlob(k,dfc,b); nb!=nil { moved[key] = nb }
+	}
+	return moved
+}
+
+// Returns the new copy of b, if it has been rotated.
+func rotated(moved map[string]AbstractBlob, b AbstractBlob) (AbstractBlob,bool) {
+	if _,ok := b.(*BlobLocation); !ok { return b,false }
+	nb,ok := moved[string(encodeBlob(b))]
+	if !ok { return b,false }
+	return nb,true
+}
+
+func (g *GrpArtDB) rotateDayfile(k *Keyring, dfc *DayfileCache, group []byte) (n int,err error) {
+	var blobs []AbstractBlob
+	g.DB.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(tLocal).Bucket(group)
+		if bkt==nil { return nil }
+		return bkt.ForEach(func(key, v []byte) error {
+			location := new(ArticleLocation)
+			if ce_ArticleLocationPtr.Read(preciseio.PreciseReader{bytes.NewReader(v)}, reflect.ValueOf(location))!=nil { return nil }
+			if location.Head!=nil { blobs = append(blobs,location.Head) }
+			if location.Body!=nil { blobs = append(blobs,location.Body) }
+			return nil
+		})
+	})
+	moved := rotateBlobs(k,dfc,blobs)
+	if len(moved)==0 { return }
+	err = g.DB.Update(func(tx *bolt.Tx) error {
+		n = 0
+		bkt := tx.Bucket(tLocal).Bucket(group)
+		if bkt==nil { return nil }
+		var keys,values [][]byte
+		buf := new(bytes.Buffer)
+		w := preciseio.PreciseWriterFromPool()
+		defer w.PutToPool()
+		w.W = buf
+		bkt.ForEach(func(key, v []byte) error {
+			location := new(ArticleLocation)
+			if ce_ArticleLocationPtr.Read(preciseio.PreciseReader{bytes.NewReader(v)}, reflect.ValueOf(location))!=nil { return nil }
+			var h,b bool
+			location.Head,h = rotated(moved,location.Head)
+			location.Body,b = rotated(moved,location.Body)
+			if !(h||b) { return nil }
+			buf.Reset()
+			if ce_ArticleLocation.Write(w, reflect.ValueOf(*location))!=nil { return nil }
+			keys = append(keys,cloneb(key))
+			values = append(values,cloneb(buf.Bytes()))
+			return nil
+		})
+		for i,key := range keys {
+			if err := bkt.Put(key,values[i]); err!=nil { return err }
+		}
+		n = len(keys)
+		return nil
+	})
+	return
+}
+
+// Re-encrypts the deduplicated dayfile blobs (BLOB.HASH), that aren't
+// encrypted with the current key of k, like GrpArtDB.RotateKeys does for the
+// blobs referenced from GRP.ART.LOCAL.
+func (d *DedupDayfileNode) RotateKeys(k *Keyring, dfc *DayfileCache) (n int,err error) {
+	if k==nil || len(k.Current)==0 { return }
+	var blobs []AbstractBlob
+	d.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tBlobHash).ForEach(func(hash, v []byte) error {
+			if e := parseBlobHashEntry(v); e!=nil { blobs = append(blobs,e.Location) }
+			return nil
+		})
+	})
+	moved := rotateBlobs(k,dfc,blobs)
+	if len(moved)==0 { return }
+	err = d.DB.Update(func(tx *bolt.Tx) error {
+		n = 0
+		bkt := tx.Bucket(tBlobHash)
+		var keys,values [][]byte
+		bkt.ForEach(func(hash, v []byte) error {
+			e := parseBlobHashEntry(v)
+			if e==nil { return nil }
+			var ok bool
+			e.Location,ok = rotated(moved,e.Location)
+			if !ok { return nil }
+			keys = append(keys,cloneb(hash))
+			values = append(values,e.bytes())
+			return nil
+		})
+		for i,hash := range keys {
+			if err := bkt.Put(hash,values[i]); err!=nil { return err }
+		}
+		n = len(keys)
+		return nil
+	})
+	return
+}
+
+// Re-encrypts all content, that isn't encrypted with the current key of k.
+//
+// It processes one group at a time and sleeps for pause in between, so it can
+// run in the background. It returns, once everything has been processed or
+// stop has been closed. If dfc is non-nil, blobs stored in its dayfiles are
+// re-encrypted as well, by appending a new copy and updating GRP.ART.LOCAL;
+// the old copy stays in the dayfile until it is removed. Deduplicated blobs
+// are re-encrypted by DedupDayfileNode.RotateKeys.
+func (g *GrpArtDB) RotateKeys(k *Keyring, dfc *DayfileCache, pause time.Duration, stop <-chan struct{}) (n int,err error) {
+	if k==nil || len(k.Current)==0 { return }
+	wait := func() bool {
+		select {
+		case <-stop: return false
+		case <-time.After(pause): return true
+		}
+	}
+	for _,table := range [][]byte{tHead,tBody} {
+		for _,group := range g.groupBuckets(table) {
+			if !wait() { return }
+			i,e := g.rotateInline(k,table,group)
+			n += i
+			if e!=nil { return n,e }
+		}
+	}
+	if dfc==nil { return }
+	for _,group := range g.groupBuckets(tLocal) {
+		if !wait() { return }
+		i,e := g.rotateDayfile(k,dfc,group)
+		n += i
+		if e!=nil { return n,e }
+	}
+	return
+}
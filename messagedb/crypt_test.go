@@ -0,0 +1,142 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "github.com/boltdb/bolt"
+import "path/filepath"
+import "fmt"
+import "bytes"
+import "reflect"
+import "testing"
+
+func openTestDB(t *testing.T) *bolt.DB {
+	db,err := bolt.Open(filepath.Join(t.TempDir(),"test.db"),0600,nil)
+	if err!=nil { t.Fatal(err) }
+	t.Cleanup(func(){ db.Close() })
+	return db
+}
+
+func testKeyring(t *testing.T, ids ...string) *Keyring {
+	k := new(Keyring)
+	for i,id := range ids {
+		if err := k.AddKey([]byte(id),bytes.Repeat([]byte{byte(i+1)},32)); err!=nil { t.Fatal(err) }
+	}
+	return k
+}
+
+func readRawBlob(t *testing.T, db *bolt.DB, table, group []byte, num int64) (b AbstractBlob) {
+	db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(table).Bucket(group)
+		if bkt==nil { return nil }
+		b = decodeBlob(bkt.Get(encode64(num)))
+		return nil
+	})
+	return
+}
+
+func TestInlineContentEncrypted(t *testing.T) {
+	g := &GrpArtDB{DB:openTestDB(t),Keyring:testKeyring(t,"k1")}
+	if err := g.Initialize(); err!=nil { t.Fatal(err) }
+	group := []byte("alt.test")
+	head := []byte("Subject: secret\r\n")
+	body := []byte("the secret body\r\n")
+	ap := &ArticlePosting{
+		Redir: &ArticleRedirect{group,1},
+		Head: &BlobDirect{head},
+		Body: &BlobDirect{body},
+	}
+	if !g.PutArticle(group,1,ap) { t.Fatal("PutArticle failed") }
+	
+	for _,table := range [][]byte{tHead,tBody} {
+		raw := readRawBlob(t,g.DB,table,group,1)
+		if _,ok := raw.(*BlobEncrypted); !ok { t.Errorf("%s: stored as %T, want *BlobEncrypted",table,raw) }
+	}
+	
+	h,b,ok := g.GetArticle(group,1,true,true)
+	if !ok { t.Fatal("GetArticle failed") }
+	if !reflect.DeepEqual(h,&BlobDirect{head}) { t.Errorf("head = %v",h) }
+	if !reflect.DeepEqual(b,&BlobDirect{body}) { t.Errorf("body = %v",b) }
+	
+	st := g.GetCompressionStats(group)
+	if st.StoredBytes!=st.RawBytes { t.Errorf("stats include cipher overhead: raw %d, stored %d",st.RawBytes,st.StoredBytes) }
+}
+
+// Inline ciphertexts are bound to their article: moving one to another article
+// or table makes it undecryptable.
+func TestInlineContentBound(t *testing.T) {
+	g := &GrpArtDB{DB:openTestDB(t),Keyring:testKeyring(t,"k1")}
+	if err := g.Initialize(); err!=nil { t.Fatal(err) }
+	group := []byte("alt.test")
+	for num := int64(1); num<=2; num++ {
+		ap := &ArticlePosting{
+			Redir: &ArticleRedirect{group,num},
+			Head: &BlobDirect{[]byte(fmt.Sprintf("Subject: %d\r\n",num))},
+			Body: &BlobDirect{[]byte(fmt.Sprintf("body %d\r\n",num))},
+		}
+		if !g.PutArticle(group,num,ap) { t.Fatal("PutArticle failed") }
+	}
+	copyRaw := func(srcTable, dstTable []byte, src, dst int64) {
+		g.DB.Update(func(tx *bolt.Tx) error {
+			v := cloneb(tx.Bucket(srcTable).Bucket(group).Get(encode64(src)))
+			return tx.Bucket(dstTable).Bucket(group).Put(encode64(dst),v)
+		})
+	}
+	copyRaw(tBody,tBody,1,2)
+	if _,b,_ := g.GetArticle(group,2,false,true); b!=nil { t.Errorf("body moved to another article decrypted: %v",b) }
+	copyRaw(tBody,tHead,1,1)
+	if h,_,_ := g.GetArticle(group,1,true,false); h!=nil { t.Errorf("body moved into the head decrypted: %v",h) }
+}
+
+func TestRotateInline(t *testing.T) {
+	g := &GrpArtDB{DB:openTestDB(t),Keyring:testKeyring(t,"k1")}
+	if err := g.Initialize(); err!=nil { t.Fatal(err) }
+	group := []byte("alt.test")
+	body := []byte("rotated body\r\n")
+	ap := &ArticlePosting{Redir: &ArticleRedirect{group,1}, Body: &BlobDirect{body}}
+	if !g.PutArticle(group,1,ap) { t.Fatal("PutArticle failed") }
+	if err := g.Keyring.AddKey([]byte("k2"),bytes.Repeat([]byte{2},32)); err!=nil { t.Fatal(err) }
+	if n,err := g.RotateKeys(g.Keyring,nil,0,nil); err!=nil || n!=1 { t.Fatalf("RotateKeys = %d,%v",n,err) }
+	if eb,ok := readRawBlob(t,g.DB,tBody,group,1).(*BlobEncrypted); !ok || string(eb.KeyID)!="k2" { t.Errorf("not rotated") }
+	if _,b,ok := g.GetArticle(group,1,false,true); !ok || !reflect.DeepEqual(b,&BlobDirect{body}) { t.Errorf("body = %v",b) }
+}
+
+// Deduplicated dayfile blobs are rotated through BLOB.HASH.
+func TestRotateDedup(t *testing.T) {
+	d := newTestDedup(t)
+	dfc := d.IDayfileNode.(*DayfileCache)
+	dfc.Keyring = testKeyring(t,"k1")
+	content := &BlobDirect{[]byte("deduplicated content")}
+	ref := d.AddDayfileBlob(1,CH_None,content)
+	if _,ok := ref.(*BlobContentRef); !ok { t.Fatalf("stored as %T",ref) }
+	old := d.lookup(ContentHash(content))
+	
+	if err := dfc.Keyring.AddKey([]byte("k2"),bytes.Repeat([]byte{2},32)); err!=nil { t.Fatal(err) }
+	if n,err := d.RotateKeys(dfc.Keyring,dfc); err!=nil || n!=1 { t.Fatalf("RotateKeys = %d,%v",n,err) }
+	if reflect.DeepEqual(d.lookup(ContentHash(content)),old) { t.Error("BLOB.HASH still points to the old copy") }
+	if n := d.refCount(ContentHash(content)); n!=1 { t.Errorf("refcount = %d, want 1",n) }
+	if b := d.ReadDayfileBlob(ref); !reflect.DeepEqual(Decompress(b),content) { t.Errorf("content = %v",b) }
+	if n,_ := d.RotateKeys(dfc.Keyring,dfc); n!=0 { t.Errorf("second pass rotated %d blobs",n) }
+}
@@ -34,6 +34,7 @@ type IGrpArtDB interface{
 	PutArticle(group []byte,num int64, ap *ArticlePosting) (ok bool)
 	GetArticle(group []byte,num int64, head, body bool) (headPtr, bodyPtr AbstractBlob, ok bool)
 	GetXover(group []byte,first,last int64, max int) (result []XoverElement)
+	GetArticleNumbers(group []byte) (nums []int64)
 }
 
 var tXover = []byte("GRP.ART.XOVER")
@@ -43,6 +44,18 @@ var tHead  = []byte("GRP.ART.HEAD" )
 var tBody  = []byte("GRP.ART.BODY" )
 type GrpArtDB struct{
 	DB *bolt.DB
+	
+	// If set, overrides the compression hints of the ArticlePosting.
+	Policy CompressionPolicy
+	
+	// If set, heads are compressed using the trained head dictionary.
+	Dict *DictionaryDB
+	
+	// If set, content is stored raw, if compression doesn't pay off.
+	Adaptive *AdaptivePolicy
+	
+	// If set, content stored inline is encrypted.
+	Keyring *Keyring
 }
 
 func (g *GrpArtDB) Initialize() error {
@@ -52,13 +65,23 @@ func (g *GrpArtDB) Initialize() error {
 		tx.CreateBucketIfNotExists(tLocal)
 		tx.CreateBucketIfNotExists(tHead)
 		tx.CreateBucketIfNotExists(tBody)
+		tx.CreateBucketIfNotExists(tCompStats)
 		return nil
 	})
 }
 
 func (g *GrpArtDB) PutArticle(group []byte,num int64, ap *ArticlePosting) (ok bool) {
-	ap_Head := ap.HeadComp.Compress(ap.Head)
-	ap_Body := ap.BodyComp.Compress(ap.Body)
+	headComp,bodyComp := ap.HeadComp,ap.BodyComp
+	if h,b,ok := g.Policy.Lookup(group); ok { headComp,bodyComp = h,b }
+	ap_Head,headSkip := g.Adaptive.CompressWith(headComp,ap.Head,g.Dict.CompressHead)
+	ap_Body,bodySkip := g.Adaptive.Compress(bodyComp,ap.Body)
+	
+	// Inline content is encrypted before it is stored. The compression stats
+	// are taken from the compressed blobs, so that the cipher overhead does
+	// not skew them.
+	enc_Head := g.Keyring.EncryptWith(ap_Head,articleAD(tHead,group,num))
+	enc_Body := g.Keyring.EncryptWith(ap_Body,articleAD(tBody,group,num))
+	if (ap_Head!=nil && enc_Head==nil) || (ap_Body!=nil && enc_Body==nil) { return false }
 	
 	ok = g.DB.Batch(func(tx *bolt.Tx) error {
 		buf := new(bytes.Buffer)
@@ -97,7 +120,7 @@ func (g *GrpArtDB) PutArticle(group []byte,num int64, ap *ArticlePosting) (ok bo
 		if ap_Head!=nil && location.Head==nil {
 			bkt,err := headDB.CreateBucketIfNotExists(group)
 			if err!=nil { return err }
-			ce_AbstractBlob.Write(w, reflect.ValueOf(ap_Head))
+			ce_AbstractBlob.Write(w, reflect.ValueOf(enc_Head))
 			bkt.Put(numbuf,cloneb(buf.Bytes()))
 			buf.Reset()
 		}
@@ -105,11 +128,19 @@ func (g *GrpArtDB) PutArticle(group []byte,num int64, ap *ArticlePosting) (ok bo
 		if ap_Body!=nil && location.Body==nil {
 			bkt,err := bodyDB.CreateBucketIfNotExists(group)
 			if err!=nil { return err }
-			ce_AbstractBlob.Write(w, reflect.ValueOf(ap_Body))
+			ce_AbstractBlob.Write(w, reflect.ValueOf(enc_Body))
 			bkt.Put(numbuf,cloneb(buf.Bytes()))
 			buf.Reset()
 		}
 		
+		{
+			var stats CompressionStats
+			if location.Head==nil { stats.add(ap.Head,ap_Head,headSkip) }
+			if location.Body==nil { stats.add(ap.Body,ap_Body,bodySkip) }
+			err := g.updateCompressionStats(tx,group,&stats)
+			if err!=nil { return err }
+		}
+		
 		if location.Head!=nil || location.Body!=nil {
 			bkt,err := locaDB.CreateBucketIfNotExists(group)
 			if err!=nil { return err }
@@ -122,6 +153,31 @@ func (g *GrpArtDB) PutArticle(group []byte,num int64, ap *ArticlePosting) (ok bo
 	return
 }
 
+// Removes an article from all tables. The references to its content in the
+// dayfiles are dropped through node, if it implements IDayfileReleaser (like
+// DedupDayfileNode). node may be nil.
+func (g *GrpArtDB) ExpireArticle(group []byte,num int64, node IDayfileNode) (ok bool) {
+	location := new(ArticleLocation)
+	ok = g.DB.Update(func(tx *bolt.Tx) error {
+		enc := encode64(num)
+		if bkt := tx.Bucket(tLocal).Bucket(group); bkt!=nil {
+			ce_ArticleLocationPtr.Read(preciseio.PreciseReader{bytes.NewReader(bkt.Get(enc))}, reflect.ValueOf(location))
+		}
+		for _,table := range [][]byte{tXover,tRedir,tLocal,tHead,tBody} {
+			bkt := tx.Bucket(table).Bucket(group)
+			if bkt==nil { continue }
+			if err := bkt.Delete(enc); err!=nil { return err }
+		}
+		return nil
+	})==nil
+	if !ok { return }
+	if r,isR := node.(IDayfileReleaser); isR {
+		if location.Head!=nil { r.ReleaseDayfileBlob(location.Head) }
+		if location.Body!=nil { r.ReleaseDayfileBlob(location.Body) }
+	}
+	return
+}
+
 func (g *GrpArtDB) GetArticle(group []byte,num int64, head, body bool) (headPtr, bodyPtr AbstractBlob, ok bool) {
 	g.DB.View(func(tx *bolt.Tx) error {
 		enc := encode64(num)
@@ -155,6 +211,13 @@ func (g *GrpArtDB) GetArticle(group []byte,num int64, head, body bool) (headPtr,
 		
 		return nil
 	})
+	
+	headPtr = g.Keyring.DecryptWith(headPtr,articleAD(tHead,group,num))
+	bodyPtr = g.Keyring.DecryptWith(bodyPtr,articleAD(tBody,group,num))
+	
+	// Dictionaries are only known locally, so resolve them here.
+	if _,isDict := headPtr.(*BlobDictCompressed); isDict { headPtr = Decompress(headPtr) }
+	if _,isDict := bodyPtr.(*BlobDictCompressed); isDict { bodyPtr = Decompress(bodyPtr) }
 	return
 }
 
@@ -184,4 +247,18 @@ func (g *GrpArtDB) GetXover(group []byte,first,last int64, max int) (result []Xo
 	return
 }
 
+// Returns the numbers of all articles of a group, in ascending order.
+func (g *GrpArtDB) GetArticleNumbers(group []byte) (nums []int64) {
+	g.DB.View(func(tx *bolt.Tx) error {
+		xoverDB := tx.Bucket(tXover)
+		if xoverDB==nil { return nil }
+		bkt := xoverDB.Bucket(group)
+		if bkt==nil { return nil }
+		return bkt.ForEach(func(k, v []byte) error {
+			nums = append(nums,decode64(k))
+			return nil
+		})
+	})
+	return
+}
 
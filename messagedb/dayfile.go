@@ -32,13 +32,18 @@ import "github.com/hashicorp/golang-lru/simplelru"
 import "sync"
 import "os"
 import "fmt"
+import "time"
 
 import (
+	"errors"
 	"io"
 	"bufio"
 	"bytes"
 )
 
+var EEncrypt = errors.New("encryption failed")
+var EDecrypt = errors.New("decryption failed")
+
 type LruCache interface{
 	Add(key, value interface{}) bool
 	Contains(key interface{}) (ok bool)
@@ -57,33 +62,159 @@ func NewLruCache(size int) LruCacheFactory {
 
 type DayfileCache struct{
 	Folder string
-	NodeID *uuid.UUID
+	NodeID *uuid.UUID // If nil, it is loaded from the folder (see Init).
+	
+	Identity *NodeIdentity // Set by Init.
+	
+	// Maps timestamps to day IDs (see AddDayfileBlobAt).
+	Scheme DayIDScheme
+	
+	// Multiple folders (JBOD). If set, Folder is ignored.
+	Folders   []string
+	Placement Placement
+	
+	// If set, content is encrypted.
+	Keyring *Keyring
+	
+	// Cold tier. See MigrateCold().
+	ColdFolder string
+	ColdAge    time.Duration // Age (since last write), after which dayfiles are moved.
+	ColdCodec  CompressionHint
+	Remap      func(dayid int, remap map[int64]*BlobLocation) error
+	
+	// Number of blobs to prefetch, once sequential reads are detected (0 disables readahead).
+	Readahead      int
+	ReadaheadCache int // Maximum number of prefetched blobs. Defaults to 1024.
+	ra *readahead
+	
+	// Maximum number of cached dayfile handles, if Init is called without factory.
+	// Handles, that are still in use, are closed after their last user is done.
+	MaxOpenFiles int
 	
 	c LruCache
-	mutex sync.Mutex
+	mutex sync.Mutex // Protects c and days.
+	days  map[int]*dayLock
+	
+	writers map[int]*dayWriter
+	wmutex  sync.Mutex // Protects writers.
+	
+	volumes []*volume
+	vmap    map[int]*volume
+	vmutex  sync.Mutex
+	rr      int
+}
+
+// Serializes the opening (and migration) of a single dayfile.
+type dayLock struct{
+	sync.Mutex
+	users int
+}
+
+// Serializes the appends to a single dayfile. It is shared by all handles of
+// the day, as a handle, that has been evicted from the cache, may still be
+// written to, while a new handle is already in use.
+type dayWriter struct{
+	sync.Mutex
+	handles int
+}
+
+func (dfc *DayfileCache) grabWriter(dayid int) *dayWriter {
+	dfc.wmutex.Lock(); defer dfc.wmutex.Unlock()
+	w,ok := dfc.writers[dayid]
+	if !ok {
+		w = new(dayWriter)
+		dfc.writers[dayid] = w
+	}
+	w.handles++
+	return w
+}
+func (dfc *DayfileCache) dropWriter(dayid int) {
+	dfc.wmutex.Lock(); defer dfc.wmutex.Unlock()
+	w := dfc.writers[dayid]
+	w.handles--
+	if w.handles<1 { delete(dfc.writers,dayid) }
+}
+
+func (dfc *DayfileCache) lockDay(dayid int) *dayLock {
+	dfc.mutex.Lock()
+	l,ok := dfc.days[dayid]
+	if !ok {
+		l = new(dayLock)
+		dfc.days[dayid] = l
+	}
+	l.users++
+	dfc.mutex.Unlock()
+	l.Lock()
+	return l
 }
+func (dfc *DayfileCache) unlockDay(dayid int, l *dayLock) {
+	l.Unlock()
+	dfc.mutex.Lock(); defer dfc.mutex.Unlock()
+	l.users--
+	if l.users<1 { delete(dfc.days,dayid) }
+}
+
+// If f is nil, a LRU-Cache with MaxOpenFiles (default 256) entries is used.
 func (dfc *DayfileCache) Init(f LruCacheFactory) error {
+	if f==nil {
+		size := dfc.MaxOpenFiles
+		if size<=0 { size = 256 }
+		f = NewLruCache(size)
+	}
 	c,e := f(closeDayfile)
 	if e!=nil { return e }
 	dfc.c = c
-	return nil
+	dfc.days = make(map[int]*dayLock)
+	dfc.writers = make(map[int]*dayWriter)
+	if dfc.Readahead>0 { dfc.ra = newReadahead(dfc.ReadaheadCache) }
+	dfc.initVolumes()
+	if e = dfc.initIdentity(); e!=nil { return e }
+	return dfc.initScheme()
 }
-func (dfc *DayfileCache) GetFile(dayid int) *Dayfile {
+
+func (dfc *DayfileCache) cached(dayid int) *Dayfile {
 	dfc.mutex.Lock(); defer dfc.mutex.Unlock()
 	obj,ok := dfc.c.Get(dayid)
-	if ok { return obj.(*Dayfile).Grab() }
+	if !ok { return nil }
+	return obj.(*Dayfile).tryGrab()
+}
+
+// Returns the dayfile with an additional reference. The caller must Drop() it.
+//
+// Only the cache lookup is done under the global lock. Opening a dayfile only
+// blocks other users of the same day.
+func (dfc *DayfileCache) GetFile(dayid int) *Dayfile {
+	if df := dfc.cached(dayid); df!=nil { return df }
+	
+	l := dfc.lockDay(dayid)
+	defer dfc.unlockDay(dayid,l)
+	
+	// Opened by someone else, while we were waiting?
+	if df := dfc.cached(dayid); df!=nil { return df }
 	
-	f,err := os.OpenFile(fmt.Sprintf("%s/%x",dfc.Folder,dayid),os.O_RDWR|os.O_CREATE,0600)
+	path := dfc.path(dayid)
+	if path=="" { return nil }
+	f,err := os.OpenFile(path,os.O_RDWR|os.O_CREATE,0600)
 	if err!=nil {
+		dfc.CheckVolumes()
 		return nil
 	}
 	
-	dayfile := (&Dayfile{ File: f }).Grab().Grab()
+	dayfile := &Dayfile{ File: f, Keyring: dfc.Keyring }
+	if dayfile.initHeader(dfc.NodeID,dayid)!=nil {
+		f.Close()
+		return nil
+	}
+	dayfile.refc = 2 // One for the cache, one for the caller.
+	dayfile.writer = dfc.grabWriter(dayid)
+	dayfile.release = func() { dfc.dropWriter(dayid) }
 	
+	dfc.mutex.Lock(); defer dfc.mutex.Unlock()
 	dfc.c.Add(dayid,dayfile)
 	return dayfile
 }
 func (dfc *DayfileCache) Close() error {
+	dfc.mutex.Lock(); defer dfc.mutex.Unlock()
 	dfc.c.Purge()
 	return nil
 }
@@ -94,21 +225,50 @@ func closeDayfile(key interface{}, value interface{}) {
 }
 type Dayfile struct{
 	File *os.File
+	Keyring *Keyring
+	
+	Header     *DayfileHeader // nil for legacy dayfiles.
+	DataOffset int64          // Offset of the first record.
 	mutex sync.Mutex
 	refc  int
+	idle  *sync.Cond // Signaled by Drop, see drain.
+	
+	writer  *dayWriter // If nil, appends are serialized by mutex.
+	release func()     // Called, once the file has been closed.
 }
 func (d *Dayfile) Grab() *Dayfile {
 	d.mutex.Lock(); defer d.mutex.Unlock()
 	d.refc++
 	return d
 }
+
+// Like Grab, but returns nil, if the dayfile has already been closed.
+func (d *Dayfile) tryGrab() *Dayfile {
+	d.mutex.Lock(); defer d.mutex.Unlock()
+	if d.refc<1 { return nil }
+	d.refc++
+	return d
+}
 func (d *Dayfile) Drop() {
 	d.mutex.Lock(); defer d.mutex.Unlock()
 	d.refc--
-	if d.refc<1 { d.File.Close() }
+	if d.refc==0 {
+		d.File.Close()
+		if d.release!=nil { d.release() }
+	}
+	if d.idle!=nil { d.idle.Broadcast() }
 }
-func (d *Dayfile) put(buf *bytes.Buffer) (int64,error) {
+
+// Blocks until no more than n references are left.
+func (d *Dayfile) drain(n int) {
 	d.mutex.Lock(); defer d.mutex.Unlock()
+	if d.idle==nil { d.idle = sync.NewCond(&d.mutex) }
+	for d.refc>n { d.idle.Wait() }
+}
+func (d *Dayfile) put(buf *bytes.Buffer) (int64,error) {
+	var w sync.Locker = &d.mutex
+	if d.writer!=nil { w = d.writer }
+	w.Lock(); defer w.Unlock()
 	offset,e := d.File.Seek(0,2)
 	if e!=nil { return offset,e }
 	
@@ -120,6 +280,8 @@ func (d *Dayfile) put(buf *bytes.Buffer) (int64,error) {
 func (d *Dayfile) Add(node *uuid.UUID, dayid int, ch CompressionHint, b AbstractBlob) (AbstractBlob,error) {
 	b = ch.Compress(b)
 	if b==nil || !b.IsDirect() { return b,nil }
+	b = d.Keyring.Encrypt(b)
+	if b==nil { return nil,EEncrypt }
 	
 	buf := new(bytes.Buffer)
 	w := preciseio.PreciseWriterFromPool()
@@ -134,22 +296,66 @@ func (d *Dayfile) Add(node *uuid.UUID, dayid int, ch CompressionHint, b Abstract
 	
 	return blob,nil
 }
-func (d *Dayfile) Read(b *BlobLocation) (res AbstractBlob,err error) {
+func (d *Dayfile) readRaw(b *BlobLocation) (res AbstractBlob,err error) {
 	sr := io.NewSectionReader(d.File,b.Offset,b.Length)
 	br := bufio.NewReader(sr)
 	err = ce_AbstractBlob.Read(preciseio.PreciseReader{br},reflect.ValueOf(&res).Elem())
 	return
 }
+func (d *Dayfile) Read(b *BlobLocation) (res AbstractBlob,err error) {
+	res,err = d.readRaw(b)
+	if err!=nil { return }
+	if _,enc := res.(*BlobEncrypted); enc {
+		res = d.Keyring.Decrypt(res)
+		if res==nil { err = EDecrypt }
+	}
+	return
+}
+
+type countingReader struct{
+	r *bufio.Reader
+	n int64
+}
+func (c *countingReader) Read(p []byte) (n int,err error) {
+	n,err = c.r.Read(p)
+	c.n += int64(n)
+	return
+}
+func (c *countingReader) ReadByte() (b byte,err error) {
+	b,err = c.r.ReadByte()
+	if err==nil { c.n++ }
+	return
+}
+
+// Iterates over the records of the dayfile, starting at offset.
+//
+// The records are passed to f undecrypted. The iteration stops, if f returns false.
+// It returns nil at the end of the file, or an error, if a record couldn't be decoded.
+func (d *Dayfile) scan(offset int64, f func(offset, length int64, b AbstractBlob) bool) error {
+	st,err := d.File.Stat()
+	if err!=nil { return err }
+	size := st.Size()
+	if offset>=size { return nil }
+	cr := &countingReader{bufio.NewReader(io.NewSectionReader(d.File,offset,size-offset)),offset}
+	for cr.n<size {
+		start := cr.n
+		var res AbstractBlob
+		err = ce_AbstractBlob.Read(preciseio.PreciseReader{cr},reflect.ValueOf(&res).Elem())
+		if err!=nil { return fmt.Errorf("offset %d: %v",start,err) }
+		if !f(start,cr.n-start,res) { return nil }
+	}
+	return nil
+}
 
 type IDayfileNode interface{
 	GetDayfileNodeID() *uuid.UUID
 	FreeDayfileStorage() int64
 	AddDayfileBlob(dayid int, ch CompressionHint, b AbstractBlob) AbstractBlob
+	AddDayfileBlobAt(ts int64, ch CompressionHint, b AbstractBlob) AbstractBlob
 	ReadDayfileBlob(b AbstractBlob) AbstractBlob
 }
 
 func (dfc *DayfileCache) GetDayfileNodeID() *uuid.UUID { return dfc.NodeID }
-func (dfc *DayfileCache) FreeDayfileStorage() int64 { return -1 }
 
 func (dfc *DayfileCache) AddDayfileBlob(dayid int, ch CompressionHint, b AbstractBlob) AbstractBlob {
 	df := dfc.GetFile(dayid)
@@ -162,15 +368,20 @@ func (dfc *DayfileCache) AddDayfileBlob(dayid int, ch CompressionHint, b Abstrac
 }
 
 func (dfc *DayfileCache) ReadDayfileBlob(b AbstractBlob) AbstractBlob {
-	if b==nil || !b.IsDirect() { return b }
+	if b==nil || b.IsDirect() { return b }
 	bl,ok := b.(*BlobLocation)
 	if !ok || bl==nil { return nil }
 	
+	if dfc.ra!=nil {
+		res,st,prefetch := dfc.ra.read(bl)
+		if prefetch>=0 { go dfc.prefetch(bl.DayID,st,prefetch) }
+		if res!=nil { return res }
+	}
+	
 	df := dfc.GetFile(bl.DayID)
 	if df==nil { return nil }
 	defer df.Drop()
 	
-	fmt.Println(bl)
 	res,_ := df.Read(bl)
 	return res
 }
@@ -0,0 +1,224 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "github.com/nu7hatch/gouuid"
+import "bytes"
+import "fmt"
+import "math/rand"
+import "os"
+import "path/filepath"
+import "strings"
+import "sync"
+import "testing"
+
+// Writes to and reads from thousands of dayfiles through a cache, that is
+// much smaller, so that handles are evicted, while other goroutines still use
+// them, and several handles of the same day are written to at once. All
+// blobs are read back at the end, to detect records, that overwrote each
+// other. Run with -race.
+func TestDayfileCacheStress(t *testing.T) {
+	dfc := &DayfileCache{Folder:t.TempDir(),MaxOpenFiles:4}
+	if err := dfc.Init(nil); err!=nil { t.Fatal(err) }
+	defer dfc.Close()
+	
+	const workers,rounds,days = 8,2000,4096
+	type written struct{
+		loc     AbstractBlob
+		content []byte
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error,workers)
+	results := make([][]written,workers)
+	for w := 0; w<workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i<rounds; i++ {
+				// The workers move through the days together, each picking one
+				// of a few adjacent days, which is more than the cache holds.
+				dayid := (i+rng.Intn(8))%days
+				content := []byte(fmt.Sprintf("worker %d round %d day %d",w,i,dayid))
+				loc := dfc.AddDayfileBlob(dayid,CH_None,&BlobDirect{content})
+				if loc==nil { errs <- fmt.Errorf("AddDayfileBlob(%d) failed",dayid); return }
+				results[w] = append(results[w],written{loc,content})
+				if res,_ := dfc.ReadDayfileBlob(loc).(*BlobDirect); res==nil || !bytes.Equal(res.Content,content) {
+					errs <- fmt.Errorf("day %d: read back %v, want %q",dayid,res,content)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs { t.Error(err) }
+	
+	for _,r := range results {
+		for _,e := range r {
+			if res,_ := dfc.ReadDayfileBlob(e.loc).(*BlobDirect); res==nil || !bytes.Equal(res.Content,e.content) {
+				t.Errorf("%v: read back %v, want %q",e.loc,res,e.content)
+			}
+		}
+	}
+}
+
+// A handle, that has been evicted while in use, and the handle, that replaced
+// it, must append under the same lock.
+func TestDayfileSharedWriter(t *testing.T) {
+	dfc := &DayfileCache{Folder:t.TempDir(),MaxOpenFiles:1}
+	if err := dfc.Init(nil); err!=nil { t.Fatal(err) }
+	defer dfc.Close()
+	
+	old := dfc.GetFile(1)
+	dfc.GetFile(2).Drop() // Evicts day 1.
+	cur := dfc.GetFile(1)
+	if cur==old { t.Fatal("day 1 has not been evicted") }
+	if old.writer==nil || old.writer!=cur.writer { t.Fatalf("handles use different writers: %p, %p",old.writer,cur.writer) }
+	
+	var wg sync.WaitGroup
+	locs := make([][]AbstractBlob,2)
+	for i,df := range []*Dayfile{old,cur} {
+		wg.Add(1)
+		go func(i int, df *Dayfile) {
+			defer wg.Done()
+			for j := 0; j<100; j++ {
+				b,err := df.Add(dfc.NodeID,1,CH_None,&BlobDirect{[]byte(fmt.Sprintf("%d/%d",i,j))})
+				if err!=nil { t.Error(err); return }
+				locs[i] = append(locs[i],b)
+			}
+		}(i,df)
+	}
+	wg.Wait()
+	for i := range locs {
+		for j,b := range locs[i] {
+			res,_ := dfc.ReadDayfileBlob(b).(*BlobDirect)
+			if want := fmt.Sprintf("%d/%d",i,j); res==nil || string(res.Content)!=want { t.Errorf("%v: read back %v, want %q",b,res,want) }
+		}
+	}
+	
+	old.Drop()
+	if n := dfc.writers[1].handles; n!=1 { t.Errorf("%d handles registered for day 1, want 1",n) }
+	cur.Drop()
+}
+
+func TestDayIDSchemePersisted(t *testing.T) {
+	folder := t.TempDir()
+	dfc := &DayfileCache{Folder:folder}
+	if err := dfc.Init(nil); err!=nil { t.Fatal(err) }
+	if dfc.AddDayfileBlobAt(3*int64(Daily),CH_None,&BlobDirect{[]byte("x")})==nil { t.Fatal("AddDayfileBlobAt failed") }
+	dfc.Close()
+	
+	for _,tc := range []struct{
+		name string
+		g    Granularity
+		err  error
+	}{
+		{"default",0,nil},
+		{"daily",Daily,nil},
+		{"hourly",Hourly,EGranularityMismatch},
+		{"weekly",Weekly,EGranularityMismatch},
+	} {
+		dfc := &DayfileCache{Folder:folder,Scheme:DayIDScheme{tc.g}}
+		err := dfc.Init(nil)
+		if err==nil { dfc.Close() }
+		if (err==nil)!=(tc.err==nil) || (err!=nil && !strings.Contains(err.Error(),tc.err.Error())) {
+			t.Errorf("%s: got %v, want %v",tc.name,err,tc.err)
+		}
+	}
+}
+
+func TestInitSkipsDownVolumes(t *testing.T) {
+	dir := t.TempDir()
+	up,down := filepath.Join(dir,"up"),filepath.Join(dir,"down")
+	if err := os.Mkdir(up,0700); err!=nil { t.Fatal(err) }
+	for _,tc := range []struct{
+		name    string
+		folders []string
+		cold    string
+		err     error
+	}{
+		{"one down",[]string{up,down},"",nil},
+		{"cold missing",[]string{up},down,nil},
+		{"all down",[]string{down},"",ENoVolume},
+	} {
+		dfc := &DayfileCache{Folders:tc.folders,ColdFolder:tc.cold}
+		err := dfc.Init(nil)
+		if err!=tc.err { t.Errorf("%s: Init = %v, want %v",tc.name,err,tc.err) }
+		if err!=nil { continue }
+		if dfc.AddDayfileBlob(1,CH_None,&BlobDirect{[]byte("x")})==nil { t.Errorf("%s: AddDayfileBlob failed",tc.name) }
+		dfc.Close()
+	}
+}
+
+// New writes for a day, whose volume went down, are placed on another volume.
+func TestDownVolumeRelocates(t *testing.T) {
+	dir := t.TempDir()
+	a,b := filepath.Join(dir,"a"),filepath.Join(dir,"b")
+	for _,f := range []string{a,b} {
+		if err := os.Mkdir(f,0700); err!=nil { t.Fatal(err) }
+	}
+	dfc := &DayfileCache{Folders:[]string{a,b},MaxOpenFiles:1}
+	if err := dfc.Init(nil); err!=nil { t.Fatal(err) }
+	defer dfc.Close()
+	if dfc.AddDayfileBlob(1,CH_None,&BlobDirect{[]byte("x")})==nil { t.Fatal("AddDayfileBlob failed") }
+	if p := dfc.hotPath(1); p!=(&volume{folder:a}).path(1) { t.Fatalf("day 1 placed at %s",p) }
+	
+	dfc.Close() // Drop the open handle.
+	if err := os.Rename(a,a+".dead"); err!=nil { t.Fatal(err) }
+	dfc.AddDayfileBlob(1,CH_None,&BlobDirect{[]byte("y")}) // Detects the dead volume.
+	if dfc.AddDayfileBlob(1,CH_None,&BlobDirect{[]byte("z")})==nil { t.Fatal("AddDayfileBlob failed after the volume went down") }
+	if p := dfc.hotPath(1); p!=(&volume{folder:b}).path(1) { t.Errorf("day 1 relocated to %s",p) }
+}
+
+func TestParseDayfileHeader(t *testing.T) {
+	full := (&DayfileHeader{dayfileVersion,new(uuid.UUID),7,1}).bytes()
+	legacy := encodeBlob(&BlobDirect{[]byte("legacy")})
+	for _,tc := range []struct{
+		name   string
+		b      []byte
+		header bool
+		err    error
+	}{
+		{"empty",nil,false,nil},
+		{"header",full,true,nil},
+		{"legacy",legacy,false,nil},
+		{"partial magic",[]byte(dayfileMagic[:3]),false,EDayfileTruncated},
+		{"magic only",[]byte(dayfileMagic),false,EDayfileTruncated},
+		{"cut header",full[:DayfileHeaderSize-1],false,EDayfileTruncated},
+	} {
+		h,err := parseDayfileHeader(tc.b)
+		if (h!=nil)!=tc.header || err!=tc.err { t.Errorf("%s: got %v,%v",tc.name,h,err) }
+	}
+	
+	// A dayfile with a cut header is refused, instead of being appended to.
+	folder := t.TempDir()
+	dfc := &DayfileCache{Folder:folder}
+	if err := dfc.Init(nil); err!=nil { t.Fatal(err) }
+	defer dfc.Close()
+	if err := os.WriteFile(filepath.Join(folder,"5"),full[:20],0600); err!=nil { t.Fatal(err) }
+	if dfc.AddDayfileBlob(5,CH_None,&BlobDirect{[]byte("x")})!=nil { t.Error("blob appended to a dayfile with a cut header") }
+}
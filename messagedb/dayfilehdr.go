@@ -0,0 +1,122 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "github.com/nu7hatch/gouuid"
+import "encoding/binary"
+import "errors"
+import "io"
+import "os"
+import "time"
+
+// Dayfile header layout (big endian, padded to DayfileHeaderSize):
+//
+//	0  [8]  magic "ADB-DAYF"
+//	8  [2]  format version
+//	10 [16] node UUID
+//	26 [8]  day ID
+//	34 [8]  creation time (UNIX-Format)
+const DayfileHeaderSize = 64
+const dayfileMagic = "ADB-DAYF"
+const dayfileVersion = 1
+
+var EDayfileHeader = errors.New("dayfile header mismatch")
+var EDayfileTruncated = errors.New("dayfile header truncated")
+
+type DayfileHeader struct{
+	Version int
+	Node    *uuid.UUID
+	DayID   int
+	Created int64 // Timestamp (UNIX-Format).
+}
+
+func (h *DayfileHeader) bytes() []byte {
+	b := make([]byte,DayfileHeaderSize)
+	copy(b,dayfileMagic)
+	binary.BigEndian.PutUint16(b[8:],uint16(h.Version))
+	if h.Node!=nil { copy(b[10:26],h.Node[:]) }
+	binary.BigEndian.PutUint64(b[26:],uint64(h.DayID))
+	binary.BigEndian.PutUint64(b[34:],uint64(h.Created))
+	return b
+}
+
+// Parses a header. Returns nil, if b doesn't start with the magic (legacy
+// dayfile). b holds the first DayfileHeaderSize bytes of the file, or the
+// whole file, if it is shorter.
+//
+// Legacy dayfiles start with a blob tag, which is never the first byte of the
+// magic. So, if b starts with (a part of) the magic, but is shorter than the
+// header, the header has been cut short, and EDayfileTruncated is returned.
+func parseDayfileHeader(b []byte) (*DayfileHeader,error) {
+	if len(b)==0 { return nil,nil }
+	m := len(b)
+	if m>len(dayfileMagic) { m = len(dayfileMagic) }
+	if string(b[:m])!=dayfileMagic[:m] { return nil,nil }
+	if len(b)<DayfileHeaderSize { return nil,EDayfileTruncated }
+	h := new(DayfileHeader)
+	h.Version = int(binary.BigEndian.Uint16(b[8:]))
+	h.Node = new(uuid.UUID)
+	copy(h.Node[:],b[10:26])
+	h.DayID = int(int64(binary.BigEndian.Uint64(b[26:])))
+	h.Created = int64(binary.BigEndian.Uint64(b[34:]))
+	return h,nil
+}
+
+// Reads the header of a dayfile. Returns nil, if it is a legacy dayfile.
+func readDayfileHeader(path string) (*DayfileHeader,error) {
+	f,err := os.Open(path)
+	if err!=nil { return nil,err }
+	defer f.Close()
+	buf := make([]byte,DayfileHeaderSize)
+	n,err := f.ReadAt(buf,0)
+	if err!=nil && err!=io.EOF { return nil,err }
+	return parseDayfileHeader(buf[:n])
+}
+
+// Writes the header of a new (empty) dayfile, or validates the header of an
+// existing one. Legacy dayfiles without header are accepted as they are.
+func (d *Dayfile) initHeader(node *uuid.UUID, dayid int) error {
+	d.mutex.Lock(); defer d.mutex.Unlock()
+	st,err := d.File.Stat()
+	if err!=nil { return err }
+	if st.Size()==0 {
+		h := &DayfileHeader{dayfileVersion,node,dayid,time.Now().Unix()}
+		_,err = d.File.WriteAt(h.bytes(),0)
+		if err!=nil { return err }
+		d.Header,d.DataOffset = h,DayfileHeaderSize
+		return nil
+	}
+	buf := make([]byte,DayfileHeaderSize)
+	n,err := d.File.ReadAt(buf,0)
+	if err!=nil && err!=io.EOF { return err }
+	h,err := parseDayfileHeader(buf[:n])
+	if err!=nil { return err }
+	if h==nil { return nil } // Legacy dayfile.
+	if h.Version>dayfileVersion || h.DayID!=dayid { return EDayfileHeader }
+	if node!=nil && *h.Node!=*node { return EDayfileHeader }
+	d.Header,d.DataOffset = h,DayfileHeaderSize
+	return nil
+}
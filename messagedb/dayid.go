@@ -0,0 +1,141 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "errors"
+import "fmt"
+import "io/ioutil"
+import "os"
+import "path/filepath"
+import "sort"
+import "time"
+
+// Length of the period covered by one dayfile, in seconds.
+type Granularity int64
+const (
+	Hourly Granularity = 60*60
+	Daily  Granularity = 24*Hourly
+	Weekly Granularity = 7*Daily
+)
+
+// Maps timestamps to day IDs.
+//
+// A day ID is the number of periods since the UNIX epoch (in UTC, so it does
+// not depend on the local timezone). Weekly periods start on thursdays, like
+// the epoch. The zero value uses daily periods.
+type DayIDScheme struct{
+	Granularity Granularity
+}
+
+func (s DayIDScheme) period() int64 {
+	if s.Granularity<=0 { return int64(Daily) }
+	return int64(s.Granularity)
+}
+
+// Returns the day ID of a timestamp (UNIX-Format).
+func (s DayIDScheme) DayIDUnix(ts int64) int {
+	p := s.period()
+	d := ts/p
+	if ts%p<0 { d-- } // Round towards negative infinity.
+	return int(d)
+}
+
+// Returns the day ID of a point in time.
+func (s DayIDScheme) DayID(t time.Time) int { return s.DayIDUnix(t.Unix()) }
+
+// Returns the beginning of the period of a day ID.
+func (s DayIDScheme) Start(dayid int) time.Time {
+	return time.Unix(int64(dayid)*s.period(),0).UTC()
+}
+
+// Returns the beginning of the following period.
+func (s DayIDScheme) End(dayid int) time.Time { return s.Start(dayid+1) }
+
+// Returns the range of day IDs covering the time window [from,to].
+func (s DayIDScheme) Range(from, to time.Time) (first, last int) {
+	return s.DayID(from),s.DayID(to)
+}
+
+const schemeFile = "dayid.scheme"
+const schemeMagic = "articledb-dayid"
+
+var EGranularityMismatch = errors.New("dayfile folder uses a different day ID granularity")
+
+func readScheme(folder string) (p int64, err error) {
+	data,err := ioutil.ReadFile(filepath.Join(folder,schemeFile))
+	if err!=nil { return 0,err }
+	var magic string
+	n,_ := fmt.Sscanf(string(data),"%s %d",&magic,&p)
+	if n!=2 || magic!=schemeMagic || p<=0 { return 0,fmt.Errorf("malformed %s file",schemeFile) }
+	return
+}
+
+func writeScheme(folder string, p int64) error {
+	path := filepath.Join(folder,schemeFile)
+	tmp := path+".tmp"
+	err := ioutil.WriteFile(tmp,[]byte(fmt.Sprintf("%s %d\n",schemeMagic,p)),0600)
+	if err!=nil { return err }
+	return os.Rename(tmp,path)
+}
+
+// Verifies (or creates) the scheme files of all folders, next to the identity
+// files. The day IDs of existing dayfiles are only meaningful with the
+// granularity they have been created with, so a mismatch returns
+// EGranularityMismatch. Folders without scheme file, that already contain
+// dayfiles, predate the scheme and are assumed to be daily.
+func (dfc *DayfileCache) initScheme() error {
+	p := dfc.Scheme.period()
+	var missing []string
+	for _,folder := range dfc.folders() {
+		q,err := readScheme(folder)
+		if os.IsNotExist(err) {
+			if len(folderDayIDs(folder))>0 && p!=int64(Daily) { return fmt.Errorf("%s: %v",folder,EGranularityMismatch) }
+			missing = append(missing,folder)
+			continue
+		}
+		if err!=nil { return fmt.Errorf("%s: %v",folder,err) }
+		if q!=p { return fmt.Errorf("%s: %v",folder,EGranularityMismatch) }
+	}
+	for _,folder := range missing {
+		if err := writeScheme(folder,p); err!=nil { return err }
+	}
+	return nil
+}
+
+// Stores a blob in the dayfile covering the timestamp (UNIX-Format).
+func (dfc *DayfileCache) AddDayfileBlobAt(ts int64, ch CompressionHint, b AbstractBlob) AbstractBlob {
+	return dfc.AddDayfileBlob(dfc.Scheme.DayIDUnix(ts),ch,b)
+}
+
+// Returns the (sorted) day IDs of the existing dayfiles covering the time window [from,to].
+func (dfc *DayfileCache) DayIDsBetween(from, to time.Time) (ids []int) {
+	first,last := dfc.Scheme.Range(from,to)
+	for _,id := range dfc.DayIDs() {
+		if id>=first && id<=last { ids = append(ids,id) }
+	}
+	sort.Ints(ids)
+	return
+}
@@ -0,0 +1,210 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "github.com/byte-mug/golibs/preciseio"
+import "github.com/byte-mug/golibs/serializer"
+import "github.com/boltdb/bolt"
+import "crypto/sha256"
+import "bytes"
+import "reflect"
+import "sync"
+
+var tBlobHash = []byte("BLOB.HASH")
+
+type blobHashEntry struct{
+	Location AbstractBlob
+	RefCount int64
+}
+var ce_blobHashEntry = serializer.WithInline(new(blobHashEntry)).
+	FieldWith("Location",ce_AbstractBlob).
+	Field("RefCount")
+//
+
+func parseBlobHashEntry(b []byte) *blobHashEntry {
+	if len(b)==0 { return nil }
+	e := new(blobHashEntry)
+	err := ce_blobHashEntry.Read(preciseio.PreciseReader{bytes.NewReader(b)}, reflect.ValueOf(e).Elem())
+	if err!=nil || e.Location==nil { return nil }
+	return e
+}
+func (e *blobHashEntry) bytes() []byte {
+	buf := new(bytes.Buffer)
+	w := preciseio.PreciseWriterFromPool()
+	defer w.PutToPool()
+	w.W = buf
+	ce_blobHashEntry.Write(w, reflect.ValueOf(e).Elem())
+	return buf.Bytes()
+}
+
+// Computes the content hash (SHA-256) of a blob, after decompressing it.
+//
+// Returns nil, if b is nil, not direct or not decompressible.
+func ContentHash(b AbstractBlob) []byte {
+	bd,ok := Decompress(b).(*BlobDirect)
+	if !ok || bd==nil { return nil }
+	h := sha256.Sum256(bd.Content)
+	return h[:]
+}
+
+// A IDayfileNode wrapper, that stores identical blobs only once.
+//
+// Every blob is indexed by its content hash. If a blob with the same content
+// has already been stored, its reference count is incremented and a
+// BlobContentRef is returned instead of storing the blob again. The references
+// are dropped by GrpArtDB.ExpireArticle.
+type DedupDayfileNode struct{
+	IDayfileNode
+	DB *bolt.DB
+	
+	mutex  sync.Mutex // Protects hashes.
+	hashes map[string]*hashLock
+}
+
+// Serializes the writers of the same content, so that it is stored only once.
+type hashLock struct{
+	sync.Mutex
+	users int
+}
+
+func (d *DedupDayfileNode) lockHash(hash []byte) *hashLock {
+	d.mutex.Lock()
+	if d.hashes==nil { d.hashes = make(map[string]*hashLock) }
+	l,ok := d.hashes[string(hash)]
+	if !ok {
+		l = new(hashLock)
+		d.hashes[string(hash)] = l
+	}
+	l.users++
+	d.mutex.Unlock()
+	l.Lock()
+	return l
+}
+func (d *DedupDayfileNode) unlockHash(hash []byte, l *hashLock) {
+	l.Unlock()
+	d.mutex.Lock(); defer d.mutex.Unlock()
+	l.users--
+	if l.users<1 { delete(d.hashes,string(hash)) }
+}
+
+func (d *DedupDayfileNode) Initialize() error {
+	return d.DB.Update(func(tx *bolt.Tx) error {
+		tx.CreateBucketIfNotExists(tBlobHash)
+		return nil
+	})
+}
+
+// Increments the reference count, if the hash is known.
+func (d *DedupDayfileNode) addRef(hash []byte) (ok bool) {
+	d.DB.Batch(func(tx *bolt.Tx) error {
+		ok = false
+		bkt := tx.Bucket(tBlobHash)
+		e := parseBlobHashEntry(bkt.Get(hash))
+		if e==nil { return nil }
+		e.RefCount++
+		ok = bkt.Put(hash,e.bytes())==nil
+		return nil
+	})
+	return
+}
+
+// Registers a freshly stored blob. The caller holds the lock of the hash.
+func (d *DedupDayfileNode) putRef(hash []byte, loc AbstractBlob) (ok bool) {
+	d.DB.Batch(func(tx *bolt.Tx) error {
+		ok = tx.Bucket(tBlobHash).Put(hash,(&blobHashEntry{loc,1}).bytes())==nil
+		return nil
+	})
+	return
+}
+
+func (d *DedupDayfileNode) lookup(hash []byte) (loc AbstractBlob) {
+	d.DB.View(func(tx *bolt.Tx) error {
+		e := parseBlobHashEntry(tx.Bucket(tBlobHash).Get(hash))
+		if e!=nil { loc = e.Location }
+		return nil
+	})
+	return
+}
+
+func (d *DedupDayfileNode) AddDayfileBlob(dayid int, ch CompressionHint, b AbstractBlob) AbstractBlob {
+	return d.add(b,func() AbstractBlob { return d.IDayfileNode.AddDayfileBlob(dayid,ch,b) })
+}
+
+func (d *DedupDayfileNode) AddDayfileBlobAt(ts int64, ch CompressionHint, b AbstractBlob) AbstractBlob {
+	return d.add(b,func() AbstractBlob { return d.IDayfileNode.AddDayfileBlobAt(ts,ch,b) })
+}
+
+// Stores b using store, unless a blob with the same content is known.
+func (d *DedupDayfileNode) add(b AbstractBlob, store func() AbstractBlob) AbstractBlob {
+	hash := ContentHash(b)
+	if hash==nil { return store() }
+	
+	l := d.lockHash(hash)
+	defer d.unlockHash(hash,l)
+	if d.addRef(hash) { return &BlobContentRef{d.GetDayfileNodeID(),hash} }
+	
+	loc := store()
+	if loc==nil || loc.IsDirect() { return loc }
+	
+	if !d.putRef(hash,loc) { return loc }
+	return &BlobContentRef{d.GetDayfileNodeID(),hash}
+}
+
+func (d *DedupDayfileNode) ReadDayfileBlob(b AbstractBlob) AbstractBlob {
+	ref,ok := b.(*BlobContentRef)
+	if !ok { return d.IDayfileNode.ReadDayfileBlob(b) }
+	if ref==nil { return nil }
+	loc := d.lookup(ref.Hash)
+	if loc==nil { return nil }
+	return d.IDayfileNode.ReadDayfileBlob(loc)
+}
+
+// Implemented by IDayfileNode wrappers (like DedupDayfileNode), that count
+// the references to their blobs.
+type IDayfileReleaser interface{
+	ReleaseDayfileBlob(b AbstractBlob) (freed AbstractBlob)
+}
+
+// Drops one reference to a deduplicated blob.
+//
+// If the last reference has been removed, the index entry is deleted and the
+// underlying location is returned, so the caller can reclaim its storage.
+// Otherwise (or if b isn't a BlobContentRef) nil is returned.
+func (d *DedupDayfileNode) ReleaseDayfileBlob(b AbstractBlob) (freed AbstractBlob) {
+	ref,ok := b.(*BlobContentRef)
+	if !ok || ref==nil { return nil }
+	d.DB.Batch(func(tx *bolt.Tx) error {
+		freed = nil
+		bkt := tx.Bucket(tBlobHash)
+		e := parseBlobHashEntry(bkt.Get(ref.Hash))
+		if e==nil { return nil }
+		e.RefCount--
+		if e.RefCount>0 { return bkt.Put(ref.Hash,e.bytes()) }
+		freed = e.Location
+		return bkt.Delete(ref.Hash)
+	})
+	return
+}
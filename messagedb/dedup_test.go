@@ -0,0 +1,97 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "github.com/boltdb/bolt"
+import "fmt"
+import "sync"
+import "testing"
+
+func newTestDedup(t *testing.T) *DedupDayfileNode {
+	dfc := &DayfileCache{Folder:t.TempDir()}
+	if err := dfc.Init(nil); err!=nil { t.Fatal(err) }
+	t.Cleanup(func(){ dfc.Close() })
+	d := &DedupDayfileNode{IDayfileNode:dfc,DB:openTestDB(t)}
+	if err := d.Initialize(); err!=nil { t.Fatal(err) }
+	return d
+}
+
+func (d *DedupDayfileNode) refCount(hash []byte) (n int64) {
+	d.DB.View(func(tx *bolt.Tx) error {
+		if e := parseBlobHashEntry(tx.Bucket(tBlobHash).Get(hash)); e!=nil { n = e.RefCount }
+		return nil
+	})
+	return
+}
+
+// Concurrent writers of the same content store it only once.
+func TestDedupConcurrentAdd(t *testing.T) {
+	d := newTestDedup(t)
+	const writers = 16
+	content := &BlobDirect{[]byte("the same binary, posted again")}
+	var wg sync.WaitGroup
+	for i := 0; i<writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _,ok := d.AddDayfileBlob(1,CH_None,content).(*BlobContentRef); !ok { t.Error("no BlobContentRef returned") }
+		}()
+	}
+	wg.Wait()
+	df := d.IDayfileNode.(*DayfileCache).GetFile(1)
+	defer df.Drop()
+	records := 0
+	if err := df.scan(df.DataOffset,func(offset, length int64, b AbstractBlob) bool { records++; return true }); err!=nil { t.Fatal(err) }
+	if records!=1 { t.Errorf("%d copies stored, want 1",records) }
+	if n := d.refCount(ContentHash(content)); n!=writers { t.Errorf("refcount = %d, want %d",n,writers) }
+}
+
+// Expiring articles drops their references; the last one frees the blob.
+func TestDedupExpire(t *testing.T) {
+	d := newTestDedup(t)
+	g := &GrpArtDB{DB:d.DB}
+	if err := g.Initialize(); err!=nil { t.Fatal(err) }
+	content := &BlobDirect{[]byte("crossposted body")}
+	hash := ContentHash(content)
+	groups := []string{"alt.a","alt.b","alt.c"}
+	for _,group := range groups {
+		ap := &ArticlePosting{
+			Redir: &ArticleRedirect{[]byte(group),1},
+			Head: &BlobDirect{[]byte(fmt.Sprintf("Newsgroups: %s\r\n",group))},
+			Body: d.AddDayfileBlob(1,CH_None,content),
+		}
+		if !g.PutArticle([]byte(group),1,ap) { t.Fatal("PutArticle failed") }
+	}
+	for i,group := range groups {
+		if !g.ExpireArticle([]byte(group),1,d) { t.Fatalf("ExpireArticle(%s) failed",group) }
+		if _,_,ok := g.GetArticle([]byte(group),1,true,true); ok { t.Errorf("%s: article still there",group) }
+		if n,want := d.refCount(hash),int64(len(groups)-i-1); n!=want { t.Errorf("after %s: refcount = %d, want %d",group,n,want) }
+	}
+	if d.lookup(hash)!=nil { t.Error("index entry not deleted") }
+	
+	// Expiring again must not drop references of other articles.
+	if !g.ExpireArticle([]byte(groups[0]),1,d) { t.Error("ExpireArticle of a missing article failed") }
+}
@@ -0,0 +1,227 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "github.com/byte-mug/golibs/preciseio"
+import "github.com/boltdb/bolt"
+import "github.com/klauspost/compress/zstd"
+import "github.com/klauspost/compress/dict"
+import "bytes"
+import "errors"
+import "reflect"
+import "sync"
+
+var tDictZstd = []byte("DICT.ZSTD")
+var tDictMeta = []byte("DICT.META")
+
+var kDictHead = []byte("head")
+
+var EDictNoSamples = errors.New("no samples to train a dictionary from")
+
+type zstdDict struct{
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+var dictMutex sync.RWMutex
+var dicts = make(map[int64]*zstdDict)
+
+func newZstdDict(content []byte) (*zstdDict,error) {
+	enc,err := zstd.NewWriter(nil,zstd.WithEncoderLevel(zstd.SpeedBetterCompression),zstd.WithEncoderDict(content))
+	if err!=nil { return nil,err }
+	dec,err := zstd.NewReader(nil,zstd.WithDecoderDicts(content))
+	if err!=nil { return nil,err }
+	return &zstdDict{enc,dec},nil
+}
+func storeDict(id int64, zd *zstdDict) {
+	dictMutex.Lock(); defer dictMutex.Unlock()
+	dicts[id] = zd
+}
+func registerDict(id int64, content []byte) error {
+	zd,err := newZstdDict(content)
+	if err!=nil { return err }
+	storeDict(id,zd)
+	return nil
+}
+func lookupDict(id int64) *zstdDict {
+	dictMutex.RLock(); defer dictMutex.RUnlock()
+	return dicts[id]
+}
+
+func decompressDict(b *BlobDictCompressed) AbstractBlob {
+	d := lookupDict(b.DictID)
+	if d==nil { return nil }
+	if b.UCLen>0x7E000000 || b.UCLen<0 { return nil }
+	buf,err := d.dec.DecodeAll(b.Content,make([]byte,0,b.UCLen))
+	if err!=nil || len(buf)!=b.UCLen { return nil }
+	return &BlobDirect{buf}
+}
+
+// Trained zstd dictionaries for article heads.
+//
+// The dictionaries are stored in bolt and loaded by Initialize(), which
+// makes them available for Decompress().
+type DictionaryDB struct{
+	DB *bolt.DB
+}
+
+func (d *DictionaryDB) Initialize() error {
+	return d.DB.Update(func(tx *bolt.Tx) error {
+		bkt,err := tx.CreateBucketIfNotExists(tDictZstd)
+		if err!=nil { return err }
+		tx.CreateBucketIfNotExists(tDictMeta)
+		return bkt.ForEach(func(k, v []byte) error {
+			return registerDict(decode64(k),cloneb(v))
+		})
+	})
+}
+
+// Returns the ID of the dictionary used for new heads, or 0 if there is none.
+func (d *DictionaryDB) HeadDict() (id int64) {
+	d.DB.View(func(tx *bolt.Tx) error {
+		id = decode64(tx.Bucket(tDictMeta).Get(kDictHead))
+		return nil
+	})
+	return
+}
+
+// Trains a new dictionary from samples and makes it the dictionary for new heads.
+//
+// The training takes a while, so it runs outside of any transaction. The ID is
+// reserved beforehand; if the training fails, the ID is never used. The
+// dictionary is registered only once it has been committed.
+func (d *DictionaryDB) Train(samples [][]byte, maxSize int) (id int64,err error) {
+	if len(samples)==0 { return 0,EDictNoSamples }
+	err = d.DB.Update(func(tx *bolt.Tx) error {
+		seq,err := tx.Bucket(tDictZstd).NextSequence()
+		id = int64(seq)
+		return err
+	})
+	if err!=nil { return 0,err }
+	content,err := dict.BuildZstdDict(samples,dict.Options{
+		MaxDictSize: maxSize,
+		HashBytes: 6,
+		ZstdDictID: uint32(id),
+		ZstdLevel: zstd.SpeedBetterCompression,
+	})
+	if err!=nil { return 0,err }
+	zd,err := newZstdDict(content)
+	if err!=nil { return 0,err }
+	err = d.DB.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(tDictZstd).Put(encode64(id),content)
+		if err!=nil { return err }
+		return tx.Bucket(tDictMeta).Put(kDictHead,encode64(id))
+	})
+	if err!=nil { return 0,err }
+	storeDict(id,zd)
+	return
+}
+
+// Compresses a head using the current head dictionary.
+//
+// If d is nil, c is CH_None or there is no dictionary, it falls back to c.Compress(b).
+func (d *DictionaryDB) CompressHead(c CompressionHint, b AbstractBlob) AbstractBlob {
+	if d==nil || c==CH_None { return c.Compress(b) }
+	return compressDict(d.HeadDict(),c,b)
+}
+
+func compressDict(id int64, c CompressionHint, b AbstractBlob) AbstractBlob {
+	zd := lookupDict(id)
+	if zd==nil { return c.Compress(b) }
+	bd,ok := b.(*BlobDirect)
+	if !ok || bd==nil { return c.Compress(b) }
+	l := len(bd.Content)
+	if l>0x7E000000 || l==0 { return b }
+	dest := zd.enc.EncodeAll(bd.Content,nil)
+	if len(dest)>=l { return c.Compress(b) }
+	return &BlobDictCompressed{id,l,dest}
+}
+
+// Collects up to max (decompressed) heads stored inline as training samples.
+func (g *GrpArtDB) SampleHeads(max int) (samples [][]byte) {
+	g.DB.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(tHead).Cursor()
+		for k,v := c.First(); len(k)>0 && len(samples)<max; k,v = c.Next() {
+			if v!=nil { continue } // Not a bucket.
+			bc := c.Bucket().Bucket(k).Cursor()
+			for hk,hv := bc.First(); len(hk)>0 && len(samples)<max; hk,hv = bc.Next() {
+				var blob AbstractBlob
+				if ce_AbstractBlob.Read(preciseio.PreciseReader{bytes.NewReader(hv)}, reflect.ValueOf(&blob).Elem())!=nil { continue }
+				bd,ok := Decompress(blob).(*BlobDirect)
+				if !ok || bd==nil { continue }
+				samples = append(samples,bd.Content)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// Re-encodes all heads stored inline with the current head dictionary.
+// Heads, that don't get smaller, are left untouched.
+func (g *GrpArtDB) ReencodeHeads(d *DictionaryDB) (n int,err error) {
+	id := d.HeadDict()
+	if id==0 { return }
+	var groups [][]byte
+	g.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tHead).ForEach(func(k, v []byte) error {
+			if v==nil { groups = append(groups,cloneb(k)) }
+			return nil
+		})
+	})
+	for _,group := range groups {
+		err = g.DB.Update(func(tx *bolt.Tx) error {
+			bkt := tx.Bucket(tHead).Bucket(group)
+			if bkt==nil { return nil }
+			var keys,values [][]byte
+			buf := new(bytes.Buffer)
+			w := preciseio.PreciseWriterFromPool()
+			defer w.PutToPool()
+			w.W = buf
+			bkt.ForEach(func(k, v []byte) error {
+				var blob AbstractBlob
+				if ce_AbstractBlob.Read(preciseio.PreciseReader{bytes.NewReader(v)}, reflect.ValueOf(&blob).Elem())!=nil { return nil }
+				if db,ok := blob.(*BlobDictCompressed); ok && db.DictID==id { return nil }
+				nb := compressDict(id,CH_Zstd,Decompress(blob))
+				if nb==nil { return nil }
+				buf.Reset()
+				if ce_AbstractBlob.Write(w, reflect.ValueOf(nb))!=nil { return nil }
+				if buf.Len()>=len(v) { return nil }
+				keys = append(keys,cloneb(k))
+				values = append(values,cloneb(buf.Bytes()))
+				return nil
+			})
+			for i,k := range keys {
+				err := bkt.Put(k,values[i])
+				if err!=nil { return err }
+			}
+			n += len(keys)
+			return nil
+		})
+		if err!=nil { return }
+	}
+	return
+}
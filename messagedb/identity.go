@@ -0,0 +1,170 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "github.com/nu7hatch/gouuid"
+import "encoding/hex"
+import "errors"
+import "fmt"
+import "io/ioutil"
+import "os"
+import "path/filepath"
+import "time"
+
+const identityFile = "node.id"
+const identityMagic = "articledb-node"
+const identityVersion = 1
+
+var ENodeIDMismatch = errors.New("dayfile folder belongs to a different node")
+var EIdentity = errors.New("malformed node identity file")
+var ENoVolume = errors.New("no dayfile folder is reachable")
+
+// The identity of a dayfile node, stored in every dayfile folder.
+type NodeIdentity struct{
+	Node    *uuid.UUID
+	Created int64 // Timestamp (UNIX-Format).
+	Version int   // Format version.
+}
+
+func readIdentity(folder string) (*NodeIdentity,error) {
+	data,err := ioutil.ReadFile(filepath.Join(folder,identityFile))
+	if err!=nil { return nil,err }
+	var magic,id string
+	ni := new(NodeIdentity)
+	n,_ := fmt.Sscanf(string(data),"%s %s %d %d",&magic,&id,&ni.Created,&ni.Version)
+	if n!=4 || magic!=identityMagic { return nil,EIdentity }
+	raw,err := hex.DecodeString(id)
+	if err!=nil || len(raw)!=len(uuid.UUID{}) { return nil,EIdentity }
+	ni.Node = new(uuid.UUID)
+	copy(ni.Node[:],raw)
+	if ni.Version>identityVersion { return nil,fmt.Errorf("unsupported node identity version %d",ni.Version) }
+	return ni,nil
+}
+
+func writeIdentity(folder string, ni *NodeIdentity) error {
+	path := filepath.Join(folder,identityFile)
+	tmp := path+".tmp"
+	data := fmt.Sprintf("%s %s %d %d\n",identityMagic,hex.EncodeToString(ni.Node[:]),ni.Created,ni.Version)
+	err := ioutil.WriteFile(tmp,[]byte(data),0600)
+	if err!=nil { return err }
+	return os.Rename(tmp,path)
+}
+
+// Returns the reachable dayfile folders: the volumes, that are up, and the
+// cold folder, if it exists.
+func (dfc *DayfileCache) folders() (folders []string) {
+	for _,v := range dfc.volumes {
+		if !v.down { folders = append(folders,v.folder) }
+	}
+	if dfc.ColdFolder!="" && exists(dfc.ColdFolder) { folders = append(folders,dfc.ColdFolder) }
+	return
+}
+
+// Returns the node ID found in the headers of the dayfiles in a folder.
+// Legacy dayfiles carry no node ID; legacy reports, whether there are any.
+func folderNodeID(folder string) (node *uuid.UUID, legacy bool, err error) {
+	for _,dayid := range folderDayIDs(folder) {
+		h,err := readDayfileHeader(fmt.Sprintf("%s/%x",folder,dayid))
+		if err!=nil { return nil,false,err }
+		if h==nil || *h.Node==(uuid.UUID{}) {
+			legacy = true
+		} else if node==nil {
+			node = h.Node
+		} else if *node!=*h.Node {
+			return nil,false,ENodeIDMismatch
+		}
+	}
+	return
+}
+
+// Verifies (or creates) the identity files of all folders.
+//
+// If NodeID is nil, the identity found in the folders is adopted, or a new
+// one is generated. If NodeID disagrees with an existing identity file, it
+// returns ENodeIDMismatch, as every stored BlobLocation refers to the node ID.
+//
+// Folders without identity file, that already contain dayfiles, take the node
+// ID from the dayfile headers. If the headers can't tell (legacy dayfiles) and
+// NodeID is nil, it returns ENodeIDMismatch rather than inventing a new ID.
+// Folders, that are down, are skipped, so that the remaining volumes can be
+// served; if no volume is up, it returns ENoVolume.
+func (dfc *DayfileCache) initIdentity() error {
+	up := false
+	for _,v := range dfc.volumes { up = up || !v.down }
+	if !up { return ENoVolume }
+	
+	var ident *NodeIdentity
+	var missing []string
+	var found *uuid.UUID
+	var legacy bool
+	for _,folder := range dfc.folders() {
+		ni,err := readIdentity(folder)
+		if os.IsNotExist(err) {
+			node,leg,err := folderNodeID(folder)
+			if err!=nil { return fmt.Errorf("%s: %v",folder,err) }
+			if found!=nil && node!=nil && *found!=*node { return fmt.Errorf("%s: %v",folder,ENodeIDMismatch) }
+			if node!=nil { found = node }
+			legacy = legacy || leg
+			missing = append(missing,folder)
+			continue
+		}
+		if err!=nil { return fmt.Errorf("%s: %v",folder,err) }
+		if ident==nil {
+			ident = ni
+		} else if *ident.Node!=*ni.Node {
+			return fmt.Errorf("%s: %v",folder,ENodeIDMismatch)
+		}
+	}
+	
+	if found!=nil {
+		if ident==nil {
+			ident = &NodeIdentity{found,time.Now().Unix(),identityVersion}
+		} else if *ident.Node!=*found {
+			return ENodeIDMismatch
+		}
+	}
+	if ident==nil {
+		id := dfc.NodeID
+		if id==nil && legacy { return ENodeIDMismatch }
+		if id==nil {
+			var err error
+			id,err = uuid.NewV4()
+			if err!=nil { return err }
+		}
+		ident = &NodeIdentity{id,time.Now().Unix(),identityVersion}
+	}
+	if dfc.NodeID==nil {
+		dfc.NodeID = ident.Node
+	} else if *dfc.NodeID!=*ident.Node {
+		return ENodeIDMismatch
+	}
+	for _,folder := range missing {
+		err := writeIdentity(folder,ident)
+		if err!=nil { return err }
+	}
+	dfc.Identity = ident
+	return nil
+}
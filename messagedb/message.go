@@ -153,6 +153,48 @@ var ce_BlobLz4Compressed = serializer.StripawayPtrWith(new(BlobLz4Compressed),
 	serializer.WithInline(new(BlobLz4Compressed)).Field("UCLen").Field("Lz4Content") )
 //
 
+// A blob compressed with a registered Codec.
+//
+// All codecs share the tag 'X'; the codec is identified by the Codec byte,
+// which is its CompressionHint. So codecs can be registered without taking a
+// tag of the AbstractBlob switch, whose tags are also used by the other blob
+// types and can't be reclaimed once written to disk.
+type BlobCompressed struct{
+	Codec CompressionHint
+	UCLen int
+	Content []byte
+}
+func (b *BlobCompressed) IsDirect() bool { return true }
+
+var ce_BlobCompressed = serializer.StripawayPtrWith(new(BlobCompressed),
+	serializer.WithInline(new(BlobCompressed)).Field("Codec").Field("UCLen").Field("Content") )
+//
+
+// A blob compressed with a trained zstd dictionary (see DictionaryDB).
+type BlobDictCompressed struct{
+	DictID int64
+	UCLen int
+	Content []byte
+}
+func (b *BlobDictCompressed) IsDirect() bool { return true }
+
+var ce_BlobDictCompressed = serializer.StripawayPtrWith(new(BlobDictCompressed),
+	serializer.WithInline(new(BlobDictCompressed)).Field("DictID").Field("UCLen").Field("Content") )
+//
+
+// A blob encrypted with a key of a Keyring. The plaintext is the serialized
+// (and possibly compressed) inner blob.
+type BlobEncrypted struct{
+	KeyID []byte
+	Nonce []byte
+	Content []byte
+}
+func (b *BlobEncrypted) IsDirect() bool { return true }
+
+var ce_BlobEncrypted = serializer.StripawayPtrWith(new(BlobEncrypted),
+	serializer.WithInline(new(BlobEncrypted)).Field("KeyID").Field("Nonce").Field("Content") )
+//
+
 
 type BlobLocation struct{
 	Node *uuid.UUID
@@ -170,13 +212,31 @@ var ce_BlobLocation = serializer.StripawayPtrWith(new(BlobLocation),
 	Field("Length") )
 //
 
+// A content-addressed reference to a deduplicated blob. The Hash is resolved
+// to a BlobLocation by the node identified by Node.
+type BlobContentRef struct{
+	Node *uuid.UUID
+	Hash []byte
+}
+func (b *BlobContentRef) IsDirect() bool { return false }
+
+var ce_BlobContentRef = serializer.StripawayPtrWith(new(BlobContentRef),
+	serializer.WithInline(new(BlobContentRef)).
+	FieldWith("Node",serializer.StripawayPtr(new(uuid.UUID))).
+	Field("Hash") )
+//
+
 
 func CeAbstractBlob() serializer.CodecElement { return ce_AbstractBlob }
 
 var ce_AbstractBlob = serializer.Switch(0).
 	AddTypeWith('b',new(BlobDirect),ce_BlobDirect).
 	AddTypeWith('C',new(BlobLz4Compressed),ce_BlobLz4Compressed).
-	AddTypeWith('L',new(BlobLocation),ce_BlobLocation)
+	AddTypeWith('X',new(BlobCompressed),ce_BlobCompressed).
+	AddTypeWith('D',new(BlobDictCompressed),ce_BlobDictCompressed).
+	AddTypeWith('E',new(BlobEncrypted),ce_BlobEncrypted).
+	AddTypeWith('L',new(BlobLocation),ce_BlobLocation).
+	AddTypeWith('R',new(BlobContentRef),ce_BlobContentRef)
 //-----------------------------------------------
 
 
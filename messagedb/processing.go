@@ -35,6 +35,8 @@ func (c CompressionHint) Compress(b AbstractBlob) AbstractBlob {
 	
 	l := len(bd.Content)
 	if l>0x7E000000 || l==0 { return b }
+	if !c.UseLz4() { return c.compressCodec(bd) }
+	
 	dest := make([]byte,lz4.CompressBlockBound(l))
 	
 	var i int
@@ -45,11 +47,11 @@ func (c CompressionHint) Compress(b AbstractBlob) AbstractBlob {
 		i,err = lz4.CompressBlock(bd.Content,dest,0)
 	}
 	
-	if err!=nil || i==0 { return b }
+	if err!=nil || i==0 || i>=l { return b } // Not compressible.
 	return &BlobLz4Compressed{l,dest[:i]}
 }
 
-// Decompresses a blob (LZ4).
+// Decompresses a blob (LZ4, a registered Codec or a loaded dictionary).
 //
 // If b is nil, it returns nil.
 // If b isn't a compressed Blob, it returns b unmodified.
@@ -57,6 +59,11 @@ func (c CompressionHint) Compress(b AbstractBlob) AbstractBlob {
 func Decompress(b AbstractBlob) AbstractBlob {
 	if b==nil || !b.IsDirect() { return b }
 	
+	switch cb := b.(type) {
+	case *BlobCompressed: return decompressCodec(cb)
+	case *BlobDictCompressed: return decompressDict(cb)
+	}
+	
 	lzb,ok := b.(*BlobLz4Compressed)
 	if !ok { return b }
 	
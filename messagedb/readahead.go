@@ -0,0 +1,136 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "github.com/hashicorp/golang-lru/simplelru"
+import "sync"
+
+type raKey struct{
+	dayid  int
+	offset int64
+}
+type raEntry struct{
+	length int64
+	blob   AbstractBlob
+}
+
+// State of one sequential reader.
+type raStream struct{
+	ahead int64 // End of the prefetched region.
+	mid   int64 // Once a read passes mid, the next window is prefetched.
+	busy  bool
+	eof   bool  // The last prefetch reached the end of the dayfile.
+}
+
+// Maximum number of tracked sequential readers.
+const raMaxStreams = 256
+
+// Readahead for sequential reads. Consecutive article numbers are usually
+// stored adjacently in the same dayfile, so a read, that starts where a
+// previous read ended, is sequential. Streams are keyed by the offset, they
+// expect to be read next, so that concurrent readers of the same dayfile do
+// not disturb each other.
+type readahead struct{
+	mutex   sync.Mutex
+	cache   *simplelru.LRU // raKey -> raEntry
+	streams *simplelru.LRU // raKey (next offset) -> *raStream
+}
+
+func newReadahead(size int) *readahead {
+	if size<=0 { size = 1024 }
+	c,_ := simplelru.NewLRU(size,nil)
+	st,_ := simplelru.NewLRU(raMaxStreams,nil)
+	return &readahead{cache:c,streams:st}
+}
+
+// Looks up a prefetched blob and records the read. Returns the blob (or nil),
+// the stream and the offset to prefetch from (or -1).
+func (ra *readahead) read(bl *BlobLocation) (res AbstractBlob, st *raStream, prefetch int64) {
+	ra.mutex.Lock(); defer ra.mutex.Unlock()
+	prefetch = -1
+	if obj,ok := ra.cache.Get(raKey{bl.DayID,bl.Offset}); ok {
+		e := obj.(raEntry)
+		if e.length==bl.Length { res = e.blob }
+	}
+	end := bl.Offset+bl.Length
+	obj,sequential := ra.streams.Get(raKey{bl.DayID,bl.Offset})
+	if sequential {
+		ra.streams.Remove(raKey{bl.DayID,bl.Offset})
+		st = obj.(*raStream)
+	} else {
+		st = new(raStream)
+	}
+	ra.streams.Add(raKey{bl.DayID,end},st)
+	if end>st.ahead { st.eof = false } // The dayfile has grown since.
+	if !sequential || st.busy || st.eof || end<st.mid { return }
+	if st.ahead<end { st.ahead = end }
+	st.busy = true
+	prefetch = st.ahead
+	return
+}
+
+func (ra *readahead) store(dayid int, st *raStream, entries map[int64]raEntry, ahead, mid int64, eof bool) {
+	ra.mutex.Lock(); defer ra.mutex.Unlock()
+	for off,e := range entries { ra.cache.Add(raKey{dayid,off},e) }
+	st.busy = false
+	st.eof = eof
+	if ahead>st.ahead { st.ahead,st.mid = ahead,mid }
+}
+
+// Drops all state of a dayfile, whose content has changed (see MigrateCold).
+func (ra *readahead) forget(dayid int) {
+	if ra==nil { return }
+	ra.mutex.Lock(); defer ra.mutex.Unlock()
+	for _,lru := range []*simplelru.LRU{ra.streams,ra.cache} {
+		for _,k := range lru.Keys() {
+			if k.(raKey).dayid==dayid { lru.Remove(k) }
+		}
+	}
+}
+
+func (dfc *DayfileCache) prefetch(dayid int, st *raStream, start int64) {
+	entries := make(map[int64]raEntry)
+	ahead,mid := start,start
+	eof := true
+	df := dfc.GetFile(dayid)
+	if df!=nil {
+		n := 0
+		df.scan(start,func(offset, length int64, b AbstractBlob) bool {
+			if _,enc := b.(*BlobEncrypted); enc { b = df.Keyring.Decrypt(b) }
+			if b==nil { return false }
+			entries[offset] = raEntry{length,b}
+			ahead = offset+length
+			n++
+			if n==(dfc.Readahead+1)/2 { mid = ahead }
+			if n<dfc.Readahead { return true }
+			eof = false
+			return false
+		})
+		df.Drop()
+	}
+	if eof { mid = ahead }
+	dfc.ra.store(dayid,st,entries,ahead,mid,eof)
+}
@@ -0,0 +1,323 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "github.com/byte-mug/golibs/preciseio"
+import "github.com/byte-mug/golibs/serializer"
+import "github.com/boltdb/bolt"
+import "bytes"
+import "fmt"
+import "reflect"
+import "time"
+
+var tScrubDamaged = []byte("SCRUB.DAMAGED")
+
+// A damaged article, found by the Scrubber.
+//
+// Structural damage of a dayfile is recorded with the Group "@dayfile/<dayid>"
+// and the offset of the first undecodable record as Number.
+type ScrubDamage struct{
+	Group     []byte
+	Number    int64
+	Reason    []byte
+	TimeStamp int64 // Timestamp (UNIX-Format).
+}
+
+func CeScrubDamage() serializer.CodecElement { return ce_ScrubDamage }
+var ce_ScrubDamage = serializer.WithInline(new(ScrubDamage)).
+	Field("Group").
+	Field("Number").
+	Field("Reason").
+	Field("TimeStamp")
+//
+
+type IScrubDB interface{
+	// Returns up to max damaged articles of a group (or of all groups, if group is empty).
+	GetDamagedArticles(group []byte, max int) []ScrubDamage
+}
+
+// Key: Group ++ 0x00 ++ Number
+func scrubKey(group []byte, num int64) []byte {
+	return append(append(cloneb(group),0),encode64(num)...)
+}
+
+// Records and queries damaged articles.
+type ScrubDB struct{
+	DB *bolt.DB
+}
+
+func (s *ScrubDB) Initialize() error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		tx.CreateBucketIfNotExists(tScrubDamaged)
+		return nil
+	})
+}
+
+func (s *ScrubDB) record(group []byte, num int64, reason string) {
+	s.DB.Batch(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(tScrubDamaged)
+		k := scrubKey(group,num)
+		if reason=="" { return bkt.Delete(k) } // Healed or false alarm.
+		return bkt.Put(k,append(encode64(time.Now().Unix()),reason...))
+	})
+}
+
+func (s *ScrubDB) clear(group []byte) {
+	s.DB.Batch(func(tx *bolt.Tx) error {
+		prefix := append(cloneb(group),0)
+		c := tx.Bucket(tScrubDamaged).Cursor()
+		for k,_ := c.Seek(prefix); len(k)>0 && bytes.HasPrefix(k,prefix); k,_ = c.Seek(prefix) {
+			if err := c.Delete(); err!=nil { return err }
+		}
+		return nil
+	})
+}
+
+func (s *ScrubDB) GetDamagedArticles(group []byte, max int) (result []ScrubDamage) {
+	s.DB.View(func(tx *bolt.Tx) error {
+		var prefix []byte
+		if len(group)>0 { prefix = append(cloneb(group),0) }
+		c := tx.Bucket(tScrubDamaged).Cursor()
+		for k,v := c.Seek(prefix); len(k)>0 && len(result)<max; k,v = c.Next() {
+			if !bytes.HasPrefix(k,prefix) { break }
+			if len(k)<9 || len(v)<8 { continue }
+			i := len(k)-9
+			result = append(result,ScrubDamage{
+				Group: cloneb(k[:i]),
+				Number: decode64(k[i+1:]),
+				Reason: cloneb(v[8:]),
+				TimeStamp: decode64(v[:8]),
+			})
+		}
+		return nil
+	})
+	return
+}
+
+// A rate-limited background scrubber.
+//
+// It decodes, decrypts and decompresses every entry of GRP.ART.HEAD,
+// GRP.ART.BODY and GRP.ART.LOCAL (reading the referenced dayfile blobs) and
+// verifies the content hash of deduplicated blobs. If Dayfiles is set, it
+// also checks, that every dayfile is a sequence of decodable records.
+//
+// It is limited by the entries checked (Rate) as well as by the bytes read
+// from bolt and the dayfiles (ByteRate).
+type Scrubber struct{
+	Arts     *GrpArtDB
+	Damaged  *ScrubDB
+	Dayfile  IDayfileNode  // Used to read blobs referenced from GRP.ART.LOCAL.
+	Dayfiles *DayfileCache // Optional.
+	Rate     int           // Entries per second. Defaults to 100.
+	ByteRate int64         // Bytes per second. Defaults to 8 MiB.
+	
+	pace *pacer
+}
+
+// Dayfiles are scanned in chunks of this size. The dayfile isn't held open,
+// while the Scrubber waits in between.
+const scrubChunk = 1<<20
+
+// Limits the throughput to rate bytes per second, averaged since start.
+type pacer struct{
+	rate  int64
+	start time.Time
+	n     int64
+}
+
+func (p *pacer) add(n int64) {
+	if p!=nil { p.n += n }
+}
+
+// Waits, until the bytes added so far are within the rate. Returns false, if
+// stop has been closed.
+func (p *pacer) wait(stop <-chan struct{}) bool {
+	due := p.start.Add(time.Duration(float64(p.n)/float64(p.rate)*float64(time.Second)))
+	d := time.Until(due)
+	if d<=0 {
+		select {
+		case <-stop: return false
+		default: return true
+		}
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-stop: return false
+	case <-t.C: return true
+	}
+}
+
+func (s *Scrubber) checkContent(b AbstractBlob, keyring *Keyring, ad []byte) string {
+	if b==nil { return "undecodable blob" }
+	if _,enc := b.(*BlobEncrypted); enc {
+		b = keyring.DecryptWith(b,ad)
+		if b==nil { return "decryption failed" }
+	}
+	if Decompress(b)==nil { return "decompression failed" }
+	return ""
+}
+
+func (s *Scrubber) checkLocation(b AbstractBlob) string {
+	if b==nil || b.IsDirect() { return s.checkContent(b,s.Arts.Keyring,nil) }
+	if s.Dayfile==nil { return "" }
+	res := s.Dayfile.ReadDayfileBlob(b)
+	if res==nil { return "unreadable dayfile blob" }
+	s.pace.add(int64(blobStoredSize(res)))
+	if reason := s.checkContent(res,s.Arts.Keyring,nil); reason!="" { return reason }
+	if ref,ok := b.(*BlobContentRef); ok && !bytes.Equal(ContentHash(res),ref.Hash) {
+		return "checksum mismatch"
+	}
+	return ""
+}
+
+func (s *Scrubber) checkEntry(table, group []byte, num int64, v []byte) string {
+	if !bytes.Equal(table,tLocal) { return s.checkContent(decodeBlob(v),s.Arts.Keyring,articleAD(table,group,num)) }
+	location := new(ArticleLocation)
+	if ce_ArticleLocationPtr.Read(preciseio.PreciseReader{bytes.NewReader(v)}, reflect.ValueOf(location))!=nil {
+		return "undecodable location"
+	}
+	if location.Head!=nil {
+		if reason := s.checkLocation(location.Head); reason!="" { return "head: "+reason }
+	}
+	if location.Body!=nil {
+		if reason := s.checkLocation(location.Body); reason!="" { return "body: "+reason }
+	}
+	return ""
+}
+
+func (s *Scrubber) keys(table, group []byte) (keys [][]byte) {
+	s.Arts.DB.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(table).Bucket(group)
+		if bkt==nil { return nil }
+		return bkt.ForEach(func(k, v []byte) error {
+			keys = append(keys,cloneb(k))
+			return nil
+		})
+	})
+	return
+}
+
+// Returns the groups, that have a bucket in any of the tables.
+func (s *Scrubber) groups(tables [][]byte) (groups [][]byte) {
+	seen := make(map[string]bool)
+	for _,table := range tables {
+		for _,group := range s.Arts.groupBuckets(table) {
+			if seen[string(group)] { continue }
+			seen[string(group)] = true
+			groups = append(groups,group)
+		}
+	}
+	return
+}
+
+func (s *Scrubber) value(table, group, key []byte) (v []byte) {
+	s.Arts.DB.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(table).Bucket(group)
+		if bkt!=nil { v = cloneb(bkt.Get(key)) }
+		return nil
+	})
+	return
+}
+
+// Performs one complete pass. It returns the number of damaged articles found,
+// or early, if stop has been closed.
+func (s *Scrubber) Run(stop <-chan struct{}) (damaged int) {
+	rate := s.Rate
+	if rate<=0 { rate = 100 }
+	byteRate := s.ByteRate
+	if byteRate<=0 { byteRate = 8<<20 }
+	s.pace = &pacer{rate:byteRate,start:time.Now()}
+	defer func() { s.pace = nil }()
+	tick := time.NewTicker(time.Second/time.Duration(rate))
+	defer tick.Stop()
+	wait := func() bool {
+		select {
+		case <-stop: return false
+		case <-tick.C: return s.pace.wait(stop)
+		}
+	}
+	// An article may have entries in all three tables. The verdicts are merged
+	// and recorded once per article, so that a clean entry in one table doesn't
+	// delete the damage found in another one.
+	tables := [][]byte{tLocal,tHead,tBody}
+	for _,group := range s.groups(tables) {
+		var nums []int64
+		verdict := make(map[int64]string)
+		for _,table := range tables {
+			for _,key := range s.keys(table,group) {
+				if !wait() { return }
+				v := s.value(table,group,key)
+				if v==nil { continue } // Deleted in the meantime.
+				s.pace.add(int64(len(v)))
+				num := decode64(key)
+				reason := s.checkEntry(table,group,num,v)
+				old,seen := verdict[num]
+				if !seen { nums = append(nums,num) }
+				if old!="" && reason!="" { reason = old+"; "+reason } else if old!="" { reason = old }
+				verdict[num] = reason
+			}
+		}
+		for _,num := range nums {
+			if verdict[num]!="" { damaged++ }
+			s.Damaged.record(group,num,verdict[num])
+		}
+	}
+	if s.Dayfiles==nil { return }
+	for _,dayid := range s.Dayfiles.DayIDs() {
+		if !wait() { return }
+		var name string
+		var last int64
+		var err error
+		opened := false
+		for {
+			df := s.Dayfiles.GetFile(dayid)
+			if df==nil { break }
+			if !opened || df.File.Name()!=name {
+				// First chunk, or the dayfile has been migrated in the meantime.
+				name,last,opened = df.File.Name(),df.DataOffset,true
+			}
+			var n int64
+			err = df.scan(last,func(offset, length int64, b AbstractBlob) bool {
+				last = offset+length
+				n += length
+				return n<scrubChunk
+			})
+			df.Drop()
+			s.pace.add(n)
+			if err!=nil || n<scrubChunk { break }
+			if !s.pace.wait(stop) { return }
+		}
+		if !opened { continue }
+		group := []byte(fmt.Sprintf("@dayfile/%x",dayid))
+		s.Damaged.clear(group)
+		if err!=nil {
+			damaged++
+			s.Damaged.record(group,last,err.Error())
+		}
+	}
+	return
+}
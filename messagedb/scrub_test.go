@@ -0,0 +1,69 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "math/rand"
+import "testing"
+import "time"
+
+func newTestScrubber(t *testing.T, size int) *Scrubber {
+	dfc := &DayfileCache{Folder:t.TempDir()}
+	if err := dfc.Init(nil); err!=nil { t.Fatal(err) }
+	t.Cleanup(func(){ dfc.Close() })
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i<size; i += 256<<10 {
+		b := make([]byte,256<<10)
+		rng.Read(b)
+		if dfc.AddDayfileBlob(1,CH_None,&BlobDirect{b})==nil { t.Fatal("AddDayfileBlob failed") }
+	}
+	db := openTestDB(t)
+	g := &GrpArtDB{DB:db}
+	if err := g.Initialize(); err!=nil { t.Fatal(err) }
+	sdb := &ScrubDB{DB:db}
+	if err := sdb.Initialize(); err!=nil { t.Fatal(err) }
+	return &Scrubber{Arts:g,Damaged:sdb,Dayfile:dfc,Dayfiles:dfc,Rate:1000}
+}
+
+// The dayfile scan is limited by ByteRate.
+func TestScrubByteRate(t *testing.T) {
+	s := newTestScrubber(t,3<<20)
+	s.ByteRate = 4<<20
+	start := time.Now()
+	if n := s.Run(nil); n!=0 { t.Errorf("%d damaged",n) }
+	if d := time.Since(start); d<500*time.Millisecond { t.Errorf("3 MiB scanned in %v at 4 MiB/s",d) }
+}
+
+// A paced scan returns promptly, once stop has been closed.
+func TestScrubStop(t *testing.T) {
+	s := newTestScrubber(t,3<<20)
+	s.ByteRate = 1<<10
+	stop := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond,func(){ close(stop) })
+	start := time.Now()
+	s.Run(stop)
+	if d := time.Since(start); d>time.Second { t.Errorf("Run returned after %v",d) }
+	if dmg := s.Damaged.GetDamagedArticles(nil,10); len(dmg)!=0 { t.Errorf("interrupted scan recorded damage: %v",dmg) }
+}
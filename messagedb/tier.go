@@ -0,0 +1,254 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "github.com/byte-mug/golibs/preciseio"
+import "github.com/nu7hatch/gouuid"
+import "github.com/boltdb/bolt"
+import "bytes"
+import "errors"
+import "fmt"
+import "io"
+import "os"
+import "reflect"
+import "time"
+
+var ENoRemap = errors.New("ColdCodec requires Remap")
+
+func (dfc *DayfileCache) coldPath(dayid int) string { return fmt.Sprintf("%s/%x",dfc.ColdFolder,dayid) }
+
+func exists(path string) bool {
+	_,err := os.Stat(path)
+	return err==nil
+}
+
+// Returns the path of a dayfile, in either tier. New dayfiles are placed in the hot tier.
+func (dfc *DayfileCache) path(dayid int) string {
+	if hot := dfc.hotPath(dayid); hot!="" { return hot }
+	if dfc.ColdFolder!="" {
+		if cold := dfc.coldPath(dayid); exists(cold) { return cold }
+	}
+	return dfc.place(dayid)
+}
+
+func copyFile(dst string, src *os.File) error {
+	f,err := os.OpenFile(dst,os.O_WRONLY|os.O_CREATE|os.O_TRUNC,0600)
+	if err!=nil { return err }
+	_,err = io.Copy(f,io.NewSectionReader(src,0,1<<62))
+	if err==nil { err = f.Sync() }
+	if e := f.Close(); err==nil { err = e }
+	return err
+}
+
+// Rewrites all records of src into dst, recompressed with c.
+func (dfc *DayfileCache) recompress(dst string, src *Dayfile, dayid int, c CompressionHint) (map[int64]*BlobLocation,error) {
+	f,err := os.OpenFile(dst,os.O_WRONLY|os.O_CREATE|os.O_TRUNC,0600)
+	if err!=nil { return nil,err }
+	defer f.Close()
+	remap := make(map[int64]*BlobLocation)
+	buf := new(bytes.Buffer)
+	w := preciseio.PreciseWriterFromPool()
+	defer w.PutToPool()
+	w.W = buf
+	var offset int64
+	if src.Header!=nil {
+		h := *src.Header
+		h.Version = dayfileVersion
+		_,err = f.Write(h.bytes())
+		if err!=nil { return nil,err }
+		offset = DayfileHeaderSize
+	}
+	var ferr error
+	err = src.scan(src.DataOffset,func(old, length int64, b AbstractBlob) bool {
+		if _,enc := b.(*BlobEncrypted); enc {
+			b = dfc.Keyring.Encrypt(c.Compress(Decompress(src.Keyring.Decrypt(b))))
+		} else {
+			b = c.Compress(Decompress(b))
+		}
+		if b==nil { ferr = fmt.Errorf("offset %d: can't recompress",old); return false }
+		buf.Reset()
+		if ferr = ce_AbstractBlob.Write(w,reflect.ValueOf(b)); ferr!=nil { return false }
+		remap[old] = &BlobLocation{dfc.NodeID,dayid,offset,int64(buf.Len())}
+		var n int64
+		n,ferr = buf.WriteTo(f)
+		offset += n
+		return ferr==nil
+	})
+	if err==nil { err = ferr }
+	if err==nil { err = f.Sync() }
+	return remap,err
+}
+
+func (dfc *DayfileCache) migrate(dayid int) error {
+	hot := dfc.hotPath(dayid)
+	if hot=="" { return nil }
+	st,err := os.Stat(hot)
+	if err!=nil { return err }
+	if time.Since(st.ModTime())<dfc.ColdAge { return nil }
+	
+	df := dfc.GetFile(dayid)
+	if df==nil { return fmt.Errorf("can't open dayfile %x",dayid) }
+	defer df.Drop()
+	
+	tmp := dfc.coldPath(dayid)+".tmp"
+	var remap map[int64]*BlobLocation
+	if dfc.ColdCodec!=CH_None {
+		remap,err = dfc.recompress(tmp,df,dayid,dfc.ColdCodec)
+	} else {
+		err = copyFile(tmp,df.File)
+	}
+	if err!=nil {
+		os.Remove(tmp)
+		return err
+	}
+	
+	l := dfc.lockDay(dayid)
+	defer dfc.unlockDay(dayid,l)
+	
+	// Evict the handle, so that no new users can grab it, and wait until the
+	// writers, that already hold it, are done. Only then the size is final.
+	dfc.mutex.Lock()
+	dfc.c.Remove(dayid)
+	dfc.mutex.Unlock()
+	df.drain(1)
+	
+	st2,err := os.Stat(hot)
+	if err!=nil || !st2.ModTime().Equal(st.ModTime()) || st2.Size()!=st.Size() {
+		os.Remove(tmp)
+		return nil // Written in the meantime. Try again later.
+	}
+	cold := dfc.coldPath(dayid)
+	err = os.Rename(tmp,cold)
+	if err!=nil {
+		os.Remove(tmp)
+		return err
+	}
+	
+	// The hot file is kept, until the pointers have been updated.
+	if remap!=nil {
+		err = dfc.Remap(dayid,remap)
+		if err!=nil {
+			os.Remove(cold)
+			return err
+		}
+	}
+	
+	err = os.Remove(hot)
+	dfc.forget(dayid)
+	dfc.ra.forget(dayid)
+	return err
+}
+
+// Moves all dayfiles, that haven't been written to for ColdAge, into the cold tier.
+//
+// If ColdCodec is set, the content is recompressed with it. As this changes
+// the offsets of the blobs, it requires Remap to update the stored pointers
+// (see GrpArtDB.RemapDayfile and DedupDayfileNode.RemapDayfile); without
+// Remap, it returns ENoRemap. The hot dayfile is only removed after Remap
+// succeeded; while Remap runs, users of the migrated dayfile are blocked.
+//
+// Remap must be atomic: if it fails, the cold copy is removed again, so it
+// must not leave any pointer changed.
+func (dfc *DayfileCache) MigrateCold() (n int,err error) {
+	if dfc.ColdFolder=="" || dfc.ColdAge<=0 { return }
+	if dfc.ColdCodec!=CH_None && dfc.Remap==nil { return 0,ENoRemap }
+	for _,dayid := range dfc.DayIDs() {
+		if dfc.hotPath(dayid)=="" { continue }
+		err = dfc.migrate(dayid)
+		if err!=nil { return }
+		if dfc.hotPath(dayid)=="" { n++ }
+	}
+	return
+}
+
+func remapLocation(b AbstractBlob, node *uuid.UUID, dayid int, remap map[int64]*BlobLocation) (AbstractBlob,bool) {
+	bl,ok := b.(*BlobLocation)
+	if !ok || bl==nil || bl.DayID!=dayid || bl.Node==nil || node==nil || *bl.Node!=*node { return b,false }
+	nb,ok := remap[bl.Offset]
+	if !ok { return b,false }
+	return nb,true
+}
+
+// Updates all pointers into a dayfile (GRP.ART.LOCAL), whose content has been
+// moved. All groups are updated in one transaction, so that, if it fails, no
+// pointer refers to the new dayfile.
+func (g *GrpArtDB) RemapDayfile(node *uuid.UUID, dayid int, remap map[int64]*BlobLocation) error {
+	return g.DB.Update(func(tx *bolt.Tx) error {
+		local := tx.Bucket(tLocal)
+		var groups [][]byte
+		local.ForEach(func(k, v []byte) error {
+			if v==nil { groups = append(groups,cloneb(k)) }
+			return nil
+		})
+		buf := new(bytes.Buffer)
+		w := preciseio.PreciseWriterFromPool()
+		defer w.PutToPool()
+		w.W = buf
+		for _,group := range groups {
+			bkt := local.Bucket(group)
+			var keys,values [][]byte
+			bkt.ForEach(func(k, v []byte) error {
+				location := new(ArticleLocation)
+				if ce_ArticleLocationPtr.Read(preciseio.PreciseReader{bytes.NewReader(v)}, reflect.ValueOf(location))!=nil { return nil }
+				var h,b bool
+				location.Head,h = remapLocation(location.Head,node,dayid,remap)
+				location.Body,b = remapLocation(location.Body,node,dayid,remap)
+				if !(h||b) { return nil }
+				buf.Reset()
+				if ce_ArticleLocation.Write(w, reflect.ValueOf(*location))!=nil { return nil }
+				keys = append(keys,cloneb(k))
+				values = append(values,cloneb(buf.Bytes()))
+				return nil
+			})
+			for i,k := range keys {
+				if err := bkt.Put(k,values[i]); err!=nil { return err }
+			}
+		}
+		return nil
+	})
+}
+
+// Updates all pointers into a dayfile (BLOB.HASH), whose content has been moved.
+func (d *DedupDayfileNode) RemapDayfile(node *uuid.UUID, dayid int, remap map[int64]*BlobLocation) error {
+	return d.DB.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(tBlobHash)
+		var keys,values [][]byte
+		bkt.ForEach(func(k, v []byte) error {
+			e := parseBlobHashEntry(v)
+			if e==nil { return nil }
+			var ok bool
+			e.Location,ok = remapLocation(e.Location,node,dayid,remap)
+			if !ok { return nil }
+			keys = append(keys,cloneb(k))
+			values = append(values,e.bytes())
+			return nil
+		})
+		for i,k := range keys {
+			if err := bkt.Put(k,values[i]); err!=nil { return err }
+		}
+		return nil
+	})
+}
@@ -0,0 +1,166 @@
+/*
+MIT License
+
+Copyright (c) 2017 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package messagedb
+
+import "fmt"
+import "os"
+import "strconv"
+
+// Placement policy for new dayfiles, if there are multiple Folders.
+type Placement byte
+const (
+	PL_RoundRobin Placement = iota
+	PL_MostFree  // The folder with the most free space.
+	PL_DayHash   // Derived from the day ID.
+)
+
+type volume struct{
+	folder string
+	down   bool
+}
+func (v *volume) path(dayid int) string { return fmt.Sprintf("%s/%x",v.folder,dayid) }
+
+// Returns the day IDs of all dayfiles in a folder.
+func folderDayIDs(folder string) (ids []int) {
+	f,err := os.Open(folder)
+	if err!=nil { return }
+	defer f.Close()
+	names,_ := f.Readdirnames(-1)
+	for _,name := range names {
+		id,err := strconv.ParseInt(name,16,0)
+		if err!=nil || fmt.Sprintf("%x",id)!=name { continue }
+		ids = append(ids,int(id))
+	}
+	return
+}
+
+func (dfc *DayfileCache) initVolumes() {
+	dfc.vmutex.Lock(); defer dfc.vmutex.Unlock()
+	folders := dfc.Folders
+	if len(folders)==0 { folders = []string{dfc.Folder} }
+	dfc.volumes = make([]*volume,len(folders))
+	dfc.vmap = make(map[int]*volume)
+	for i,folder := range folders {
+		v := &volume{folder:folder}
+		dfc.volumes[i] = v
+		for _,dayid := range folderDayIDs(folder) { dfc.vmap[dayid] = v }
+	}
+	dfc.checkVolumes()
+}
+
+// Volumes, that are down, lose their day IDs, so that place() puts new
+// writes for these days on a volume, that is up.
+func (dfc *DayfileCache) checkVolumes() {
+	for _,v := range dfc.volumes {
+		st,err := os.Stat(v.folder)
+		v.down = err!=nil || !st.IsDir()
+	}
+	for dayid,v := range dfc.vmap {
+		if v.down { delete(dfc.vmap,dayid) }
+	}
+}
+
+// Re-checks the availability of all folders.
+func (dfc *DayfileCache) CheckVolumes() {
+	dfc.vmutex.Lock(); defer dfc.vmutex.Unlock()
+	dfc.checkVolumes()
+}
+
+// Returns the path of the dayfile in the hot tier, or "" if it doesn't exist there.
+func (dfc *DayfileCache) hotPath(dayid int) string {
+	dfc.vmutex.Lock(); defer dfc.vmutex.Unlock()
+	if v,ok := dfc.vmap[dayid]; ok { return v.path(dayid) }
+	for _,v := range dfc.volumes { // Created by someone else?
+		if v.down || !exists(v.path(dayid)) { continue }
+		dfc.vmap[dayid] = v
+		return v.path(dayid)
+	}
+	return ""
+}
+
+// Chooses the folder for a new dayfile and records it.
+func (dfc *DayfileCache) place(dayid int) string {
+	dfc.vmutex.Lock(); defer dfc.vmutex.Unlock()
+	var up []*volume
+	for _,v := range dfc.volumes {
+		if !v.down { up = append(up,v) }
+	}
+	if len(up)==0 { return "" }
+	var v *volume
+	switch dfc.Placement {
+	case PL_MostFree:
+		best := int64(-1)
+		for _,u := range up {
+			free,err := freeSpace(u.folder)
+			if err!=nil || free<=best { continue }
+			best,v = free,u
+		}
+		if v==nil { v = up[0] }
+	case PL_DayHash:
+		h := uint(dayid)*0x9E3779B1
+		v = up[h%uint(len(up))]
+	default:
+		v = up[dfc.rr%len(up)]
+		dfc.rr++
+	}
+	dfc.vmap[dayid] = v
+	return v.path(dayid)
+}
+
+func (dfc *DayfileCache) forget(dayid int) {
+	dfc.vmutex.Lock(); defer dfc.vmutex.Unlock()
+	delete(dfc.vmap,dayid)
+}
+
+// Returns the day IDs of all dayfiles, in all folders and tiers.
+func (dfc *DayfileCache) DayIDs() (ids []int) {
+	dfc.vmutex.Lock()
+	seen := make(map[int]bool)
+	for dayid := range dfc.vmap {
+		seen[dayid] = true
+		ids = append(ids,dayid)
+	}
+	dfc.vmutex.Unlock()
+	if dfc.ColdFolder=="" { return }
+	for _,dayid := range folderDayIDs(dfc.ColdFolder) {
+		if seen[dayid] { continue }
+		ids = append(ids,dayid)
+	}
+	return
+}
+
+func (dfc *DayfileCache) FreeDayfileStorage() int64 {
+	dfc.vmutex.Lock(); defer dfc.vmutex.Unlock()
+	total := int64(-1)
+	for _,v := range dfc.volumes {
+		if v.down { continue }
+		free,err := freeSpace(v.folder)
+		if err!=nil { continue }
+		if total<0 { total = 0 }
+		total += free
+	}
+	return total
+}
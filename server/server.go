@@ -33,12 +33,41 @@ import "net"
 const ProtocolHeader  = "DB-RPC"
 const ProtocolVersion = 0
 
+// Options for the DB-RPC server and client.
+type Options struct{
+	// Compression of the outgoing stream.
+	//
+	// Every peer announces the compression of its outgoing stream in the
+	// fastrpc handshake (after the sniff header and ProtocolVersion), so nodes
+	// with different settings, including old uncompressed nodes, interoperate.
+	Compress fastrpc.CompressType
+}
+
+// Parses a wire compression name ("none", "flate" or "snappy").
+func ParseCompressType(name string) (fastrpc.CompressType,bool) {
+	switch name {
+	case "","none": return fastrpc.CompressNone,true
+	case "flate": return fastrpc.CompressFlate,true
+	case "snappy": return fastrpc.CompressSnappy,true
+	}
+	return fastrpc.CompressNone,false
+}
+
+func (o *Options) compress() fastrpc.CompressType {
+	if o==nil { return fastrpc.CompressNone }
+	return o.Compress
+}
+
 func makeDbResponse() fastrpc.ResponseReader { return new(dbrpc.Response) }
 
 func NewServer(h *dbrpc.Handler) *fastrpc.Server {
+	return NewServerWith(h,nil)
+}
+
+func NewServerWith(h *dbrpc.Handler, o *Options) *fastrpc.Server {
 	srv := new(fastrpc.Server)
 	
-	srv.CompressType    = fastrpc.CompressNone
+	srv.CompressType    = o.compress()
 	srv.SniffHeader     = ProtocolHeader
 	srv.ProtocolVersion = ProtocolVersion
 	
@@ -49,25 +78,18 @@ func NewServer(h *dbrpc.Handler) *fastrpc.Server {
 }
 
 func NewClient(addr string) *dbrpc.Client {
-	clt := new(fastrpc.Client)
-	
-	clt.CompressType    = fastrpc.CompressNone
-	clt.SniffHeader     = ProtocolHeader
-	clt.ProtocolVersion = ProtocolVersion
-	clt.NewResponse     = makeDbResponse
-	
-	clt.Addr = addr
-	
-	dc  := new(dbrpc.Client)
-	dc.Client = clt
-	dc.Initialize()
-	return dc
+	return NewClientWith(addr,nil,nil)
 }
 
 func NewClientWithFunc(addr string, dial func(addr string) (net.Conn, error)) *dbrpc.Client {
+	return NewClientWith(addr,dial,nil)
+}
+
+// Creates a client. If dial is nil, the default dialer is used.
+func NewClientWith(addr string, dial func(addr string) (net.Conn, error), o *Options) *dbrpc.Client {
 	clt := new(fastrpc.Client)
 	
-	clt.CompressType    = fastrpc.CompressNone
+	clt.CompressType    = o.compress()
 	clt.SniffHeader     = ProtocolHeader
 	clt.ProtocolVersion = ProtocolVersion
 	clt.NewResponse     = makeDbResponse
@@ -81,5 +103,3 @@ func NewClientWithFunc(addr string, dial func(addr string) (net.Conn, error)) *d
 	return dc
 }
 
-
-